@@ -1,25 +1,115 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"nfa"
+	"os"
 )
 
 func main() {
-	lexReader, _ := nfa.NewLexReader("input.lex", "output.py")
+	/*
+		golex [-o output] [-backup file] [input.lex]
+		输出文件的后缀决定生成哪种语言的代码，例如 -o lexer.go，
+		定义部分的 %option outfile= 和 %option backend= 会覆盖命令行的设置
+	*/
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		os.Exit(lint(os.Args[2:]))
+	}
+
+	outputFile := flag.String("o", "output.py", "output file, its extension selects the backend")
+	backupFile := flag.String("backup", "lex.backup", "file written by %option backup")
+	flag.Parse()
+	inputFile := "input.lex"
+	if flag.NArg() > 0 {
+		inputFile = flag.Arg(0)
+	}
+
+	lexReader, err := nfa.NewLexReader(inputFile, *outputFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 	lexReader.Head()
 	parser, _ := nfa.NewRegParser(lexReader)
-	start := parser.Parse()
-	parser.PrintNFA(start)
+	rules := parser.ParseAST()
+	nfa.PrintAST(rules)
+	//每个开始条件对应一个起始节点
+	starts := nfa.NewAstNfaConverter().MakeNFAs(rules, lexReader.StartConditions)
+	for _, start := range starts {
+		parser.PrintNFA(start)
+	}
 	//str := "3.14"
 	//if nfa.NfaMatchString(start, str) {
 	//	fmt.Printf("string %s is accepted by given regular expression\n", str)
 	//}
 	nfaConverter := nfa.NewNfaDfaConverter()
-	nfaConverter.MakeDTran(start)
+	nfaConverter.Options = lexReader.Options
+	nfaConverter.MakeDTranFrom(starts)
 	nfaConverter.PrintDfaTransition()
+	for _, shadowed := range nfaConverter.ShadowedRules(rules) {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", shadowed.Position, shadowed)
+	}
+	if rejects := nfa.RejectRules(rules); len(rejects) > 0 {
+		//和flex一样提醒REJECT会拖慢整个扫描器，而不只是使用它的规则
+		fmt.Fprintf(os.Stderr, "%s: warning: REJECT entails a large performance penalty\n", rejects[0].Position)
+	}
 
 	nfaConverter.MinimizeDFA()
 	fmt.Println("---------new DFA transition table ----")
 	nfaConverter.PrintMinimizeDFATran()
+	if lexReader.Options.Backup {
+		writeBackup(*backupFile, nfaConverter, rules)
+	}
+
+	output, err := lexReader.CreateOutput()
+	if err != nil {
+		panic(err)
+	}
+	defer output.Close()
+	generator := nfa.NewCodeGenerator(lexReader.Options)
+	if err := generator.Generate(output, lexReader, nfaConverter.Tables(rules)); err != nil {
+		panic(err)
+	}
+}
+
+func lint(args []string) int {
+	/*
+		golex lint [input.lex] 只输出规则之间的重叠报告，不生成代码，
+		存在永远不会被匹配的规则时返回1，可以直接用于CI检查
+	*/
+	inputFile := "input.lex"
+	if len(args) > 0 {
+		inputFile = args[0]
+	}
+
+	lexReader, err := nfa.NewLexReader(inputFile, "")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	lexReader.Verbose = false
+	lexReader.Head()
+	parser, _ := nfa.NewRegParser(lexReader)
+	rules := parser.ParseAST()
+
+	nfaConverter := nfa.NewNfaDfaConverter()
+	nfaConverter.Verbose = false
+	nfaConverter.Options = lexReader.Options
+	nfaConverter.MakeDTranFrom(nfa.NewAstNfaConverter().MakeNFAs(rules, lexReader.StartConditions))
+	if !nfaConverter.Lint(os.Stdout, rules) {
+		return 1
+	}
+
+	return 0
+}
+
+func writeBackup(fileName string, nfaConverter *nfa.NfaDfaConverter, rules []*nfa.Rule) {
+	//%option backup 时和flex -b一样把可能需要回退的状态写入fileName，默认是lex.backup
+	backup, err := os.Create(fileName)
+	if err != nil {
+		panic(err)
+	}
+	defer backup.Close()
+	nfaConverter.WriteBackingUp(backup, rules, nfaConverter.BackingUpStates())
 }
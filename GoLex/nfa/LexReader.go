@@ -3,9 +3,10 @@ package nfa
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
-	"unicode"
 )
 
 type TOKEN int
@@ -36,6 +37,14 @@ const (
 	OPTIONAL                  // ?
 	OR                        // |
 	PLUS_CLOSE                // +
+	MACRO_START               //宏定义展开开始, 例如{D}
+	MACRO_END                 //宏定义展开结束
+	AND                       // & 两个表达式取交集
+	COMPLEMENT                // ~ 表达式取补集
+	CCL_DIFF                  // {-} 字符集相减
+	CCL_UNION                 // {+} 字符集合并
+	START_COND                // 规则开头的开始条件列表，例如<COMMENT,STRING>
+	EOF_RULE                  // <<EOF>>
 )
 
 type LexReader struct {
@@ -46,19 +55,72 @@ type LexReader struct {
 	Lexeme         int    //当前读取字符对应ASCII的数值
 	inquoted       bool   //读取到双引号之一
 	OutputFileName string
-	lookAhead      uint8          //当前读取字符的数值
-	tokenMap       []TOKEN        //将读取的字符对应到其对应的token值
-	currentToken   TOKEN          //当前字符对应的token
-	scanner        *bufio.Scanner //用于读取输入文件，我们需要一行行读取文件内容
+	lookAhead      uint8   //当前读取字符的数值
+	tokenMap       []TOKEN //将读取的字符对应到其对应的token值
+	currentToken   TOKEN   //当前字符对应的token
 	macroMgr       *MacroManager
-	currentInput   string   //当前读到的行
-	IFile          *os.File //读入的文件
-	OFile          *os.File //写出的文件
-	lineStack      []string //用于对正则表达式中的宏定义进行展开
-	inComment      bool     //是否读取到了注释内容
+	currentInput   string         //当前读到的行
+	IFile          *os.File       //读入的文件
+	OFile          *os.File       //写出的文件, 由CreateOutput创建
+	input          *includeFile   //当前读取的文件，我们需要一行行读取文件内容
+	includeStack   []*includeFile //被%include打断的文件
+	lineStack      []string       //用于对正则表达式中的宏定义进行展开
+	macroStack     []string       //正在展开的宏定义名称，与lineStack一一对应
+	inClass        bool           //是否在[]字符集内部
+	inComment      bool           //是否读取到了注释内容
+	Options        *LexOptions    //%option 指令设置的选项
+	HeaderCode     string         //%{ %}之间以及以空白开头的代码，原样拷贝到输出文件
+	MacroName      string         //最近一次展开的宏定义名称
+	MacroArgs      []string       //最近一次展开的宏定义调用时写的参数，没有参数列表时为nil
+	UserCode       string         //第二个%%后面的用户代码，原样拷贝到输出文件
+	peekedLine     string         //预读的一行内容
+	hasPeeked      bool           //是否有预读的内容
+	inUserCode     bool           //规则部分是否已经读取完毕
+	RulePosition   string         //当前规则在输入文件中的位置
+	RuleText       string         //当前规则中正则表达式部分的原文
+	ruleStart      bool           //是否位于一条规则的开头，只有开头可以出现<SC>和<<EOF>>
+	ConditionNames []string       //最近一次读到的开始条件列表中的名称
+	//%s 和 %x 声明的开始条件，INITIAL总是编号0
+	StartConditions []*StartCondition
+	EOFRules        []*Rule      //<<EOF>>规则，按照在输入文件中出现的顺序
+	Tokens          []*TokenDecl //%token 声明的token种类，按照声明的顺序
 }
 
 func NewLexReader(inputFile string, outputFile string) (*LexReader, error) {
+	reader := newLexReader(inputFile, outputFile)
+	var err error
+	reader.IFile, err = os.Open(inputFile)
+	if err == nil {
+		reader.input = &includeFile{
+			name:    inputFile,
+			key:     inputFile,
+			scanner: bufio.NewScanner(reader.IFile),
+		}
+		if key, err := filepath.Abs(inputFile); err == nil {
+			reader.input.key = key
+		}
+	}
+
+	return reader, err
+}
+
+func NewLexReaderFrom(r io.Reader, name string) *LexReader {
+	/*
+		从任意的io.Reader读取输入，name只用于诊断信息。
+		这样创建的LexReader使用自己的宏定义，不会和其他LexReader互相影响
+	*/
+	reader := newLexReader(name, "")
+	reader.macroMgr = newMacroManager()
+	reader.input = &includeFile{
+		name:    name,
+		key:     name,
+		scanner: bufio.NewScanner(r),
+	}
+
+	return reader
+}
+
+func newLexReader(inputFile string, outputFile string) *LexReader {
 	reader := &LexReader{
 		Verbose:        true,
 		ActualLineNo:   0,
@@ -70,19 +132,30 @@ func NewLexReader(inputFile string, outputFile string) (*LexReader, error) {
 		currentInput:   "",
 		currentToken:   EOS,
 		lineStack:      make([]string, 0),
+		macroStack:     make([]string, 0),
 		macroMgr:       GetMacroManagerInstance(),
 		inComment:      false,
+		Options:        NewLexOptions(),
+		StartConditions: []*StartCondition{
+			{Name: INITIAL},
+		},
 	}
 
-	var err error
-	reader.IFile, err = os.Open(inputFile)
-	reader.OFile, err = os.Create(outputFile)
-	if err == nil {
-		reader.scanner = bufio.NewScanner(reader.IFile)
-	}
+	reader.Options.Backend = BackendForFile(outputFile)
 	reader.initTokenMap()
 
-	return reader, err
+	return reader
+}
+
+func (l *LexReader) CreateOutput() (*os.File, error) {
+	//%option outfile= 会覆盖命令行给出的输出文件名，因此要等读完定义部分后再创建输出文件
+	if l.Options.OutFile != "" {
+		l.OutputFileName = l.Options.OutFile
+	}
+
+	var err error
+	l.OFile, err = os.Create(l.OutputFileName)
+	return l.OFile, err
 }
 
 func (l *LexReader) initTokenMap() {
@@ -105,6 +178,8 @@ func (l *LexReader) initTokenMap() {
 	l.tokenMap[uint8('{')] = OPEN_CULY
 	l.tokenMap[uint8('|')] = OR
 	l.tokenMap[uint8('}')] = CLOSE_CURLY
+	l.tokenMap[uint8('&')] = AND
+	l.tokenMap[uint8('~')] = COMPLEMENT
 }
 
 func (l *LexReader) Head() {
@@ -112,17 +187,30 @@ func (l *LexReader) Head() {
 		读取和解析宏定义部分
 	*/
 	transparent := false
-	for l.scanner.Scan() {
-		l.ActualLineNo += 1
-		l.currentInput = l.scanner.Text()
+	for {
+		line, ok := l.nextLine()
+		if !ok {
+			break
+		}
+		l.currentInput = line
 		if l.Verbose {
 			fmt.Printf("h%d: %s\n", l.ActualLineNo, l.currentInput)
 		}
 
-		if l.currentInput[0] == '%' {
+		if len(l.currentInput) == 0 {
+			//空行只在头部代码中保留
+			if transparent {
+				l.HeaderCode += "\n"
+			}
+			continue
+		}
+
+		if l.currentInput[0] == '%' && len(l.currentInput) > 1 {
 			if l.currentInput[1] == '%' {
+				if len(l.includeStack) > 0 {
+					panic(fmt.Sprintf("%s: %%%% is not allowed in included file", l.Position()))
+				}
 				//头部读取完毕
-				l.OFile.WriteString("\n")
 				break
 			} else {
 				if l.currentInput[1] == '{' {
@@ -131,17 +219,32 @@ func (l *LexReader) Head() {
 				} else if l.currentInput[1] == '}' {
 					//头部代码拷贝完毕
 					transparent = false
+				} else if strings.HasPrefix(l.currentInput, "%option") {
+					l.parseOption(l.currentInput[len("%option"):])
+				} else if strings.HasPrefix(l.currentInput, "%include") {
+					l.include(l.currentInput[len("%include"):])
+				} else if strings.HasPrefix(l.currentInput, "%token") {
+					l.declareTokens(l.currentInput[len("%token"):])
+				} else if (l.currentInput[1] == 's' || l.currentInput[1] == 'x') &&
+					(len(l.currentInput) == 2 || isWhiteSpace(l.currentInput[2])) {
+					//%s 声明包含型开始条件，%x 声明排除型开始条件
+					l.declareConditions(l.currentInput[2:], l.currentInput[1] == 'x')
 				} else {
-					err := fmt.Sprintf("illegal directive :%s \n", l.currentInput[1])
+					err := fmt.Sprintf("%s: illegal directive :%c \n", l.Position(), l.currentInput[1])
 					panic(err)
 				}
 			}
-		} else if transparent || l.currentInput[0] == ' ' {
-			l.OFile.WriteString(l.currentInput + "\n")
+		} else if transparent || isWhiteSpace(l.currentInput[0]) {
+			l.HeaderCode += l.currentInput + "\n"
 		} else {
 			//解析宏定义
-			l.macroMgr.NewMacro(l.currentInput)
-			l.OFile.WriteString("\n")
+			warnings := len(l.macroMgr.Warnings)
+			if _, err := l.macroMgr.NewMacro(l.currentInput); err != nil {
+				panic(fmt.Sprintf("%s: %s", l.Position(), err.Error()))
+			}
+			for _, warning := range l.macroMgr.Warnings[warnings:] {
+				fmt.Fprintf(os.Stderr, "%s: warning: %s\n", l.Position(), warning)
+			}
 		}
 	}
 
@@ -151,6 +254,18 @@ func (l *LexReader) Head() {
 	}
 }
 
+func (l *LexReader) parseOption(line string) {
+	/*
+		解析 %option 指令，一行可以包含多个选项，例如:
+		%option caseless noyywrap prefix=calc
+	*/
+	for _, option := range strings.Fields(line) {
+		if err := l.Options.Set(option); err != nil {
+			panic(fmt.Sprintf("%s: %s", l.Position(), err.Error()))
+		}
+	}
+}
+
 func (l *LexReader) printMacs() {
 	l.macroMgr.PrintMacs()
 }
@@ -166,7 +281,6 @@ func (l *LexReader) Advance() TOKEN {
 	*/
 	sawEsc := false //释放看到转义符
 	parseErr := NewParseError()
-	macroMgr := GetMacroManagerInstance()
 
 	if l.currentToken == EOS {
 		if l.inquoted {
@@ -174,10 +288,22 @@ func (l *LexReader) Advance() TOKEN {
 		}
 
 		l.currentInput = l.GetExpr()
+		l.lineStack = l.lineStack[0:0]
+		l.macroStack = l.macroStack[0:0]
+		l.inClass = false
 		if len(l.currentInput) == 0 {
 			l.currentToken = END_OF_INPUT
 			return l.currentToken
 		}
+		l.ruleStart = true
+	}
+
+	if l.ruleStart && len(l.currentInput) > 0 {
+		//开始条件列表后面还可以跟<<EOF>>，所以读到START_COND后仍然位于规则开头
+		if l.conditionPrefix() {
+			return l.currentToken
+		}
+		l.ruleStart = false
 	}
 
 	/*
@@ -187,33 +313,53 @@ func (l *LexReader) Advance() TOKEN {
 		也就是将字符串"*{D}"放入lineStack，然后讲D转换成[0-9]，接着解析字符串"[0-9]"，
 		解析完后再讲原来放入栈的字符串拿出来继续解析
 	*/
-	for len(l.currentInput) == 0 {
+	if len(l.currentInput) == 0 {
 		if len(l.lineStack) == 0 {
 			l.currentToken = EOS
 			return l.currentToken
 		} else {
+			/*
+				栈中的字符串都是因为展开宏定义而压入的，把它拿出来说明一个宏定义已经解析完毕，
+				这时返回MACRO_END，这样语法解析时宏定义的内容相当于被括号包裹
+			*/
 			l.currentInput = l.lineStack[len(l.lineStack)-1]
 			l.lineStack = l.lineStack[0 : len(l.lineStack)-1]
+			l.macroStack = l.macroStack[0 : len(l.macroStack)-1]
+			l.currentToken = MACRO_END
+			return l.currentToken
 		}
 	}
 
-	if !l.inquoted {
-		for l.currentInput[0] == '{' { //宏定义里面可能还会嵌套宏定义
-			//此时需要展开宏定义
-			l.currentInput = l.currentInput[1:]
-			expandedMacro := macroMgr.ExpandMacro(l.currentInput)
-			var i int
-			for i = 0; i < len(l.currentInput); i++ {
-				if l.currentInput[i] == '}' {
-					break
-				}
+	if !l.inquoted && !l.inClass {
+		//字符集内部的{是普通字符，不展开宏定义
+		if strings.HasPrefix(l.currentInput, "{-}") || strings.HasPrefix(l.currentInput, "{+}") {
+			//{-}和{+}是字符集运算符而不是宏定义
+			if l.currentInput[1] == '-' {
+				l.currentToken = CCL_DIFF
+			} else {
+				l.currentToken = CCL_UNION
 			}
-			l.lineStack = append(l.lineStack, l.currentInput[i+1:])
+			l.currentInput = l.currentInput[3:]
+			return l.currentToken
+		}
+
+		if l.currentInput[0] == '{' {
+			//此时需要展开宏定义, 宏定义里面嵌套的宏定义会在后续调用中展开
+			l.currentInput = l.currentInput[1:]
+			//带参数的宏定义在压入lineStack之前已经把参数代入了内容
+			name, args, expandedMacro, rest := l.macroMgr.ExpandMacroCall(l.currentInput)
+			l.MacroName = name
+			l.MacroArgs = args
+			l.checkMacroExpansion(l.MacroName)
+			l.lineStack = append(l.lineStack, rest)
+			l.macroStack = append(l.macroStack, l.MacroName)
 			l.currentInput = expandedMacro
+			l.currentToken = MACRO_START
+			return l.currentToken
 		}
 	}
 
-	if l.currentInput[0] == '"' {
+	if l.currentInput[0] == '"' && !l.inClass {
 		l.inquoted = !l.inquoted
 		l.currentInput = l.currentInput[1:]
 		if len(l.currentInput) == 0 {
@@ -224,7 +370,7 @@ func (l *LexReader) Advance() TOKEN {
 
 	sawEsc = l.currentInput[0] == '\\'
 	if !l.inquoted {
-		if l.currentInput[0] == ' ' {
+		if isWhiteSpace(l.currentInput[0]) && !l.inClass {
 			l.currentToken = EOS
 			return l.currentToken
 		}
@@ -250,168 +396,255 @@ func (l *LexReader) Advance() TOKEN {
 		l.currentToken = l.tokenMap[l.Lexeme]
 	}
 
+	//字符集内部的空白属于字符集，例如 [ \t]
+	if l.currentToken == CCL_START {
+		l.inClass = true
+	} else if l.currentToken == CCL_END {
+		l.inClass = false
+	}
+
 	return l.currentToken
 }
 
-func (l *LexReader) esc() int {
+func (l *LexReader) checkMacroExpansion(name string) {
 	/*
-			该函数将转义符转换成对应ASCII码并返回，如果currentInput对应的第一个字符不是反斜杠，那么它直接返回第一个字符
-		    然后currentInput递进一个字符。下列转义符将会被处理
-		   \b  backspace
-		   \f  formfeed
-		   \n  newline
-		   \r  carriage return
-		   \t  tab
-		   \e  ESC字符 对应('\0333')
-		   \^C C是任何字母，它表示控制符
+		宏定义展开前先检查它是否已经在展开路径上，例如:
+		A  x{B}
+		B  y{A}
+		展开{A}时会得到 A -> B -> A，如果不检查那么解析会一直进行下去。
+		同时展开的层数不能超过 %option macrodepth= 设置的上限
 	*/
-	var rval int
-	if l.currentInput[0] != '\\' {
-		rval = int(l.currentInput[0])
-		l.currentInput = l.currentInput[1:]
-	} else {
-		l.currentInput = l.currentInput[1:] //越过反斜杠
-		currentInputUpcase := strings.ToUpper(l.currentInput)
-		switch currentInputUpcase[0] {
-		case '\x00':
-			rval = '\\'
-		case 'B':
-			rval = '\b'
-		case 'F':
-			rval = '\f'
-		case 'N':
-			rval = '\n'
-		case 'R':
-			rval = '\r'
-		case 'S':
-			rval = ' '
-		case 'T':
-			rval = '\t'
-		case 'E':
-			rval = '\033'
-		case '^':
-			l.currentInput = l.currentInput[1:]
-			upperStr := strings.ToUpper(l.currentInput)
-			rval = int(upperStr[0] - '@')
-		case 'X':
-			rval = 0
-			savedCurrentInput := l.currentInput
-			transformHex := false
-			l.currentInput = l.currentInput[1:]
-			if l.isHexDigit(l.currentInput[0]) {
-				transformHex = true
-				rval = int(l.hex2bin(l.currentInput[0]))
-				l.currentInput = l.currentInput[1:]
-			}
-			if l.isHexDigit(l.currentInput[0]) {
-				transformHex = true
-				rval <<= 4
-				rval |= int(l.hex2bin(l.currentInput[0]))
-				l.currentInput = l.currentInput[1:]
-			}
-			if l.isHexDigit(l.currentInput[0]) {
-				transformHex = true
-				rval <<= 4
-				rval |= int(l.hex2bin(l.currentInput[0]))
-				l.currentInput = l.currentInput[1:]
-			}
-			if !transformHex {
-				//如果接在X后面的不是合法16进制字符，那么我们仅仅忽略掉X即可
-				l.currentInput = savedCurrentInput
-			}
-		default:
-			if !l.isOctDigit(l.currentInput[0]) {
-				rval = int(l.currentInput[0])
-				l.currentInput = l.currentInput[1:]
-			} else {
-				l.currentInput = l.currentInput[1:]
-				rval = int(l.oct2bin(l.currentInput[0]))
-				savedCurrentInput := l.currentInput
-				isTransformOct := false
-				l.currentInput = l.currentInput[1:]
-				if l.isOctDigit(l.currentInput[0]) {
-					isTransformOct = true
-					rval <<= 3
-					rval |= int(l.oct2bin(l.currentInput[0]))
-					l.currentInput = l.currentInput[1:]
-				}
-				if l.isOctDigit(l.currentInput[0]) {
-					isTransformOct = true
-					rval <<= 3
-					rval |= int(l.oct2bin(l.currentInput[0]))
-					l.currentInput = l.currentInput[1:]
-				}
-				if !isTransformOct {
-					l.currentInput = savedCurrentInput
-				}
-			}
+	chain := strings.Join(append(append([]string{}, l.macroStack...), name), " -> ")
+	for _, expanding := range l.macroStack {
+		if expanding == name {
+			NewParseError().ParseErrDetail(E_MACCYCLE, chain)
 		}
 	}
 
-	return rval
+	if len(l.macroStack) >= l.Options.MacroDepth {
+		NewParseError().ParseErrDetail(E_MACDEPTH, chain)
+	}
 }
 
-func (l *LexReader) isHexDigit(x uint8) bool {
-	return unicode.IsDigit(rune(x)) || ('a' <= x && x <= 'f') || ('A' <= x && x <= 'F')
+func (l *LexReader) nextLine() (string, bool) {
+	//读取下一行，如果之前有预读的内容就先返回预读的内容
+	if l.hasPeeked {
+		l.hasPeeked = false
+		return l.peekedLine, true
+	}
+
+	for !l.input.scanner.Scan() {
+		//被包含的文件读取完毕后继续读取原来的文件
+		if !l.popInclude() {
+			return "", false
+		}
+	}
+
+	l.ActualLineNo += 1
+	return l.input.scanner.Text(), true
 }
 
-func (l *LexReader) isOctDigit(x uint8) bool {
-	return '0' <= x && x <= '7'
+func (l *LexReader) unreadLine(line string) {
+	//把多读的一行放回去，下次调用nextLine时返回
+	l.peekedLine = line
+	l.hasPeeked = true
 }
 
-func (l *LexReader) hex2bin(x uint8) uint8 {
+func isWhiteSpace(c uint8) bool {
+	return c == ' ' || c == '\t'
+}
+
+func ruleAction(line string) string {
 	/*
-		将16进制字符转换为对应数值, x 必须必须是如下字符0123456789abcdefABCDEF
+		规则由正则表达式和动作两部分组成，两者之间用空白隔开，
+		双引号内，字符集内或者被转义的空白属于正则表达式，不能当作分隔
 	*/
-	var val uint8
-	if unicode.IsDigit(rune(x)) {
-		val = x - '0'
-	} else {
-		val = uint8(unicode.ToUpper(rune(x)-'A') & 0xf)
+	quoted := false
+	inClass := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\':
+			i += 1
+		case line[i] == '"' && !inClass:
+			quoted = !quoted
+		case line[i] == '[' && !quoted:
+			inClass = true
+		case line[i] == ']' && !quoted:
+			inClass = false
+		case line[i] == '{' && !quoted && !inClass:
+			//宏定义的参数可能包含双引号，例如{QUOTED(")}，需要整个跳过
+			i += macroCallLength(line[i+1:])
+		case !quoted && !inClass && isWhiteSpace(line[i]):
+			return line[i:]
+		}
 	}
 
-	return val
+	return ""
 }
 
-func (l *LexReader) oct2bin(x uint8) uint8 {
+func macroCallLength(s string) int {
+	//返回宏定义调用 NAME} 或者 NAME(args)} 的长度，格式不对时返回0
+	end := strings.IndexAny(s, "(}")
+	if end == -1 {
+		return 0
+	}
+
+	if s[end] == '(' {
+		argEnd := strings.Index(s[end:], ")}")
+		if argEnd == -1 {
+			return 0
+		}
+		return end + argEnd + 2
+	}
+
+	return end + 1
+}
+
+func braceDepth(action string) int {
 	/*
-		将十六进制的数字或字母转换为八进制数字，输入的x必须在范围'0'-'7'
+		计算动作代码中还没有闭合的大括号数量，字符串和字符常量中的大括号不计算在内，例如
+		{ printf("}"); }
 	*/
-	return (x - '0') & 0x7
+	depth := 0
+	var quote uint8 = 0
+	for i := 0; i < len(action); i++ {
+		c := action[i]
+		if quote != 0 {
+			if c == '\\' {
+				i += 1
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\'':
+			quote = c
+		case '{':
+			depth += 1
+		case '}':
+			depth -= 1
+		}
+	}
+
+	return depth
+}
+
+func (l *LexReader) copyUserCode() {
+	//第二个%%后面的内容由代码生成器原样拷贝到输出文件
+	l.inUserCode = true
+	for {
+		line, ok := l.nextLine()
+		if !ok {
+			break
+		}
+		l.UserCode += line + "\n"
+	}
+}
+
+func (l *LexReader) readAction(readLine string) string {
+	//动作代码的大括号还没有闭合时继续读取下一行，各行之间保留换行符
+	for braceDepth(ruleAction(readLine)) > 0 {
+		nextLine, ok := l.nextLine()
+		if !ok {
+			break
+		}
+		readLine += "\n" + nextLine
+	}
+
+	return readLine
+}
+
+func regexUnterminated(regex string) bool {
+	//正则表达式以|结尾，或者还有没有闭合的括号，双引号，字符集内和被转义的括号不计算在内
+	depth := 0
+	quoted := false
+	inClass := false
+	for i := 0; i < len(regex); i++ {
+		switch c := regex[i]; {
+		case c == '\\':
+			i += 1
+		case c == '"' && !inClass:
+			quoted = !quoted
+		case quoted:
+		case c == '[':
+			inClass = true
+		case c == ']':
+			inClass = false
+		case inClass:
+		case c == '(':
+			depth += 1
+		case c == ')':
+			depth -= 1
+		}
+	}
+
+	return depth > 0 || strings.HasSuffix(regex, "|")
 }
 
 func (l *LexReader) GetExpr() string {
 	/*
-		一次从文本中读入一行字符串
+		一次从文本中读入一条规则，规则的动作如果以{开始，那么它可以跨越多行，直到大括号全部闭合，例如
+		{D}+    {
+		            return ICON;
+		        }
+		读到第二个%%时规则部分结束
 	*/
 	if l.Verbose {
 		fmt.Printf("b:%d\n", l.ActualLineNo)
 	}
 
 	readLine := ""
-	haveLine := l.scanner.Scan()
-	for haveLine {
-		currentLine := l.scanner.Text()
-		haveLine = l.scanner.Scan()
+	haveLine := false
+	for !l.inUserCode {
+		currentLine, ok := l.nextLine()
+		if !ok {
+			break
+		}
+		haveLine = true
 		if len(strings.TrimSpace(currentLine)) == 0 {
 			//忽略掉全是空格的一行
 			continue
 		}
-		if currentLine[0] == uint8(' ') {
+		if strings.HasPrefix(currentLine, "%%") {
+			l.copyUserCode()
+			break
+		}
+		if isWhiteSpace(currentLine[0]) && len(readLine) > 0 {
 			/*
-					一个正则表达式可能会分成几行出现，例如 ({D)+ | {D)*\.{D)+ | {D)+\.{D)*) (e{D}+)? 可能分成三行：
-				    ({D)+ | {D)*\.{D)+
-				       |
-				       {D)+\.{D)*) (e{D}+)?
-
-				   第二行和第三行都以空格开始，这种情况我们要将三行内容全部读取，然后合成一行
+				以空白开始的行只有在规则还没有结束时才是上一行的延续，例如:
+				({D}+|
+				    {D}*\.{D}+)
+				        { return FCON; }
+				正则表达式以|结尾或者括号没有闭合时，这一行接在表达式后面，表达式中不能有空白，所以直接连接；
+				规则还没有动作时这一行就是动作，用空格和表达式隔开。规则已经完整时这一行不属于任何规则
 			*/
-			readLine += strings.TrimSpace(currentLine)
-		} else {
-			readLine = currentLine
+			continued := strings.TrimSpace(currentLine)
+			switch {
+			case strings.TrimSpace(ruleAction(readLine)) != "":
+				panic(fmt.Sprintf("%s: indented line does not continue a rule :%s", l.Position(), continued))
+			case regexUnterminated(strings.TrimSpace(readLine)):
+				readLine = strings.TrimSpace(readLine) + continued
+			default:
+				readLine = strings.TrimSpace(readLine) + " " + continued
+			}
+			readLine = l.readAction(readLine)
+			continue
+		}
+		if isWhiteSpace(currentLine[0]) {
+			readLine = strings.TrimSpace(currentLine)
+			continue
+		}
+		if len(readLine) > 0 {
+			//读到了下一条规则
+			l.unreadLine(currentLine)
 			break
 		}
 
+		readLine = currentLine
+		l.RulePosition = l.Position()
+		readLine = l.readAction(readLine)
 	}
 
 	if l.Verbose {
@@ -422,5 +655,7 @@ func (l *LexReader) GetExpr() string {
 		}
 	}
 
+	//规则的正则表达式部分，用作规则的默认名称
+	l.RuleText = strings.TrimSpace(readLine[0 : len(readLine)-len(ruleAction(readLine))])
 	return readLine
 }
@@ -0,0 +1,96 @@
+package nfa
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const threeSectionSpec = `%{
+    FCON = 1
+%}
+
+D  [0-9]
+%%
+{D}+	{
+            print("}")
+            return ICON
+        }
+{D}*\.{D}+ { return FCON }
+"}"   return '}'
+%%
+def helper():
+    pass
+`
+
+func TestThreeSections(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.lex")
+	output := filepath.Join(dir, "output.py")
+	require.Nil(t, os.WriteFile(input, []byte(threeSectionSpec), 0644))
+	lexReader, err := NewLexReader(input, output)
+	require.Nil(t, err)
+	lexReader.Head()
+	parser, _ := NewRegParser(lexReader)
+	rules := parser.ParseAST()
+
+	require.Equal(t, 3, len(rules))
+	require.Equal(t, "{\n            print(\"}\")\n            return ICON\n        }", rules[0].Action)
+	require.Equal(t, "{ return FCON }", rules[1].Action)
+	require.Equal(t, "\\}", rules[2].Regex.String())
+	require.Equal(t, "return '}'", rules[2].Action)
+	require.Equal(t, "def helper():\n    pass\n", lexReader.UserCode)
+	require.Equal(t, "    FCON = 1\n", lexReader.HeaderCode)
+}
+
+func TestBraceDepth(t *testing.T) {
+	require.Equal(t, 1, braceDepth(`{ printf("}{"); x = '}';`))
+	require.Equal(t, 0, braceDepth(`{ if (a) { b(); } }`))
+	require.Equal(t, 0, braceDepth(`return "\"{"`))
+}
+
+func TestRuleActionSkipsMacroArguments(t *testing.T) {
+	require.Equal(t, "   { x }", ruleAction("{QUOTED(\")}   { x }"))
+	require.Equal(t, " {}", ruleAction("{D}+ {}"))
+	require.Equal(t, " {}", ruleAction("[ \\t\"]+ {}"))
+}
+
+const continuationSpec = `D  [0-9]
+%%
+{D}+
+        {
+            return ICON
+        }
+([a-z]+|
+    [A-Z]+)
+        { return ID }
+[ ]+    { return SPACE }
+%%
+`
+
+func TestContinuationLines(t *testing.T) {
+	//以空白开始的行只在规则没有结束时才是上一行的延续
+	rules := parseRules(t, continuationSpec)
+	require.Equal(t, 3, len(rules))
+	require.Equal(t, "{D}+", rules[0].Name)
+	require.Equal(t, "{\n            return ICON\n        }", rules[0].Action)
+	require.Equal(t, "[a-z]+|[A-Z]+", rules[1].Regex.String())
+	require.Equal(t, "{ return ID }", rules[1].Action)
+	require.Equal(t, "{ return SPACE }", rules[2].Action)
+
+	require.True(t, regexUnterminated("(a|b"))
+	require.True(t, regexUnterminated("a|"))
+	require.False(t, regexUnterminated("[(]\"(\"\\("))
+
+	//规则已经完整时，以空白开始的行不能接在动作后面
+	func() {
+		defer func() {
+			err := recover()
+			require.NotNil(t, err)
+			require.Contains(t, err, "input.lex:3: indented line does not continue a rule :bar")
+		}()
+		parseRules(t, "%%\nfoo   {}\n    bar\n")
+	}()
+}
@@ -2,6 +2,7 @@ package nfa
 
 import (
 	"fmt"
+	"strings"
 )
 
 const (
@@ -15,6 +16,10 @@ type RegParser struct {
 	//用于打印NFA状态机信息
 	visitedMap map[*NFA]bool
 	stateNum   int
+	//当前处于多少层 (?i:...) 内部，大于0时忽略大小写
+	caselessDepth int
+	//是否在生成NFA之前化简语法树
+	Simplify bool
 }
 
 func NewRegParser(reader *LexReader) (*RegParser, error) {
@@ -24,158 +29,256 @@ func NewRegParser(reader *LexReader) (*RegParser, error) {
 		lexReader:  reader,
 		visitedMap: make(map[*NFA]bool),
 		stateNum:   0,
+		Simplify:   reader.Options.Simplify,
 	}
+	//LexReader不打印辅助信息时语法解析过程也不打印
+	regReader.debugger.Enabled = reader.Verbose
 
 	return regReader, nil
 }
 
 func (r *RegParser) Parse() *NFA {
+	//先把规则解析成语法树，再把语法树转换成NFA状态机
+	return NewAstNfaConverter().MakeNFA(r.ParseAST())
+}
+
+func (r *RegParser) ParseAST() []*Rule {
 	r.lexReader.Advance()
-	return r.machine()
+	rules := r.machine()
+	if !r.lexReader.Options.AllowEmpty {
+		/*
+			能匹配空字符串的规则会让最长匹配的词法解析器不断返回长度为0的匹配，
+			除非设置了 %option allowempty，否则这样的规则是错误
+		*/
+		for i, rule := range rules {
+			if Nullable(rule.Regex) {
+				detail := fmt.Sprintf("%s: rule %d %s, use %%option allowempty to accept it", rule.Position, i, rule.Regex)
+				r.parseErr.ParseErrDetail(E_NULLABLE, detail)
+			}
+		}
+	}
+	if r.Simplify {
+		rules = NewAstSimplifier().Simplify(rules)
+	}
+
+	return rules
 }
 
-func (r *RegParser) machine() *NFA {
+func (r *RegParser) machine() []*Rule {
 	/*
 		这里进入到正则表达式的解析,其语法规则如下：
 		machine -> rule machine | rule END_OF_INPUT
-		rule -> expr EOS action | '^'expr EOS action | expr '$' EOS action
+		rule -> '<' conditions '>' rule_body | rule_body
+		rule_body -> '<<EOF>>' EOS action | expr EOS action | '^'expr EOS action | expr '$' EOS action
+		conditions -> name ',' conditions | name | '*'
 		action -> white_space string | white_space | ε
-		expr -> expr '|' cat_expr  | cat_expr
+		expr -> expr '|' and_expr  | and_expr
+		and_expr -> and_expr '&' cat_expr | cat_expr
 		cat_expr -> cat_expr factor | factor
-		factor -> term* | term+ | term? | term
-		term -> '['string']' | '[' '^' string ']' | '[' ']' | ’[' '^' ']' | '.' | character | '(' expr ')'
+		factor -> '~' factor | class_expr* | class_expr+ | class_expr? | class_expr
+		class_expr -> class_expr '{-}' term | class_expr '{+}' term | term
+		term -> '['string']' | '[' '^' string ']' | '[' ']' | ’[' '^' ']' | '.' | character | '(' expr ')' | '(' '?' 'i' ':' expr ')' | '{' macro '}'
 		white_space -> 匹配一个或多个空格或tab
 		character -> 匹配任何一个除了空格外的ASCII字符
 		string -> 由ASCII字符组合成的字符串
 	*/
-	var p *NFA
-	var start *NFA
-
 	r.debugger.Enter("machine")
 
-	start = NewNFA()
-	p = start
-	p.next = r.rule()
-
-	for !r.lexReader.Match(END_OF_INPUT) {
-		p.next2 = NewNFA()
-		p = p.next2
-		p.next = r.rule()
+	rules := make([]*Rule, 0)
+	for {
+		rule := r.rule()
+		if rule.Regex == nil {
+			//<<EOF>>规则不参与构造状态机，只在输入结束时执行
+			r.lexReader.EOFRules = append(r.lexReader.EOFRules, rule)
+		} else {
+			rules = append(rules, rule)
+		}
+		if r.lexReader.Match(END_OF_INPUT) {
+			break
+		}
 	}
 
 	r.debugger.Leave("machine")
 
-	return start
+	return rules
 }
 
-func (r *RegParser) rule() *NFA {
+func (r *RegParser) rule() *Rule {
 	/*
 		rule -> expr EOS action
 		     ->^ expr EOS action
 		     -> expr $ EOS action
 
 		action -> <tabs> <characters> epsilon
+		       -> <tabs> => NAME
 	*/
-	var start *NFA
-	var end *NFA
 	anchor := NONE
+	items := make([]RegexNode, 0)
 
 	r.debugger.Enter("rule")
 
+	name := r.lexReader.RuleText
+	var conditions []int
+	if r.lexReader.Match(START_COND) {
+		conditions = r.conditions()
+		name = name[strings.IndexByte(name, '>')+1:]
+		r.lexReader.Advance()
+	}
+
+	if r.lexReader.Match(EOF_RULE) {
+		//<<EOF>>后面只能是动作
+		if r.lexReader.Advance() != EOS {
+			r.parseErr.ParseErr(E_BADREXPR)
+		}
+		rule := &Rule{
+			Action:          strings.TrimSpace(r.lexReader.currentInput),
+			Position:        r.lexReader.RulePosition,
+			Name:            name,
+			StartConditions: conditions,
+		}
+		r.checkTokenAction(rule)
+		r.lexReader.Advance()
+		r.debugger.Leave("rule")
+		return rule
+	}
+
 	if r.lexReader.Match(AT_BOL) {
-		/*
-			当前读到符号 ^,必须开头匹配，因此首先需要读入一个换行符，这样才能确保接下来的字符起始于新的一行
-		*/
-		start = NewNFA()
-		start.edge = EdgeType('\n')
+		//当前读到符号 ^,必须开头匹配
 		anchor |= START
+		items = append(items, &AnchorNode{Anchor: START})
 		r.lexReader.Advance()
-		start, end = r.expr(start.next, end)
-	} else {
-		start, end = r.expr(start, end)
 	}
 
+	items = append(items, r.expr())
+
 	if r.lexReader.Match(AT_EOL) {
-		/*
-			读到符号$，必须是字符串的末尾匹配，因此匹配后接下来必须是回车换行符号，要不然
-			无法确保匹配的字符串在一行的末尾
-		*/
+		//读到符号$，必须是字符串的末尾匹配
 		r.lexReader.Advance()
-		end.next = NewNFA()
-		end.edge = CCL //边对应字符集，其中包含符号/r, /n
-		end.bitset["\r"] = true
-		end.bitset["\n"] = true
-
-		end = end.next
 		anchor |= END
+		items = append(items, &AnchorNode{Anchor: END})
 	}
 
-	end.accept = r.lexReader.currentInput
-	end.anchor = anchor
+	rule := &Rule{
+		Action:   strings.TrimSpace(r.lexReader.currentInput),
+		Anchor:   anchor,
+		Position: r.lexReader.RulePosition,
+		Name:     name,
+		//没有指定开始条件时为nil，表示在所有包含型开始条件下有效
+		StartConditions: conditions,
+	}
+	r.checkTokenAction(rule)
+	if len(items) == 1 {
+		rule.Regex = items[0]
+	} else {
+		rule.Regex = &ConcatNode{Items: items}
+	}
 	r.lexReader.Advance()
 
 	r.debugger.Leave("rule")
-	return start
+	return rule
+}
+
+func (r *RegParser) checkTokenAction(rule *Rule) {
+	//动作 => NAME 中的NAME必须由%token声明
+	if name, ok := tokenAction(rule.Action); ok && r.lexReader.TokenIndex(name) == -1 {
+		r.parseErr.ParseErrDetail(E_BADTOKEN, fmt.Sprintf("%s: => %s", rule.Position, name))
+	}
 }
 
-func (r *RegParser) expr(start *NFA, end *NFA) (newStar *NFA, newEnd *NFA) {
+func (r *RegParser) conditions() []int {
 	/*
-		expr -> expr or expr | cat_expr
-		一个正则表达式可以分解成两个表达式的并，或是两个表达式的前后连接
+		把规则开头的开始条件名称转换成编号，<*>表示所有开始条件，包括排除型开始条件
 	*/
-	e2Start := NewNFA()
-	e2End := NewNFA()
-	var p *NFA
-	r.debugger.Enter("expr")
+	conditions := make([]int, 0)
+	for _, name := range r.lexReader.ConditionNames {
+		if name == "*" {
+			conditions = conditions[0:0]
+			for i := range r.lexReader.StartConditions {
+				conditions = append(conditions, i)
+			}
+			break
+		}
+		index := r.lexReader.ConditionIndex(name)
+		if index == -1 {
+			r.parseErr.ParseErrDetail(E_BADSC, fmt.Sprintf("%s: <%s>", r.lexReader.RulePosition, name))
+		}
+		conditions = append(conditions, index)
+	}
 
-	start, end = r.catExpr(start, end)
+	return conditions
+}
 
-	for r.lexReader.Match(OR) {
-		r.lexReader.Advance()
-		e2Start, e2End = r.catExpr(e2Start, e2End)
-		p = NewNFA()
-		p.next2 = e2Start
-		p.next = start
-		start = p
+func (r *RegParser) expr() RegexNode {
+	/*
+		expr -> expr or expr | and_expr
+		一个正则表达式可以分解成两个表达式的并，或是两个表达式的交集，或是两个表达式的前后连接
+	*/
+	r.debugger.Enter("expr")
 
-		p = NewNFA()
-		end.next = p
-		e2End.next = p
-		end = p
+	node := r.andExpr()
+	if r.lexReader.Match(OR) {
+		alt := &AltNode{Branches: []RegexNode{node}}
+		for r.lexReader.Match(OR) {
+			r.lexReader.Advance()
+			alt.Branches = append(alt.Branches, r.andExpr())
+		}
+		node = alt
 	}
 
 	r.debugger.Leave("expr")
 
-	return start, end
+	return node
 }
 
-func (r *RegParser) catExpr(start *NFA, end *NFA) (newStart *NFA, newEnd *NFA) {
+func (r *RegParser) andExpr() RegexNode {
 	/*
-		cat_expr -> cat_expr | factor
+		and_expr -> and_expr & cat_expr | cat_expr
+		&的优先级比|高，比前后连接低，例如 ab&cd|e 等价于 ((ab)&(cd))|e
 	*/
-	e2Start := NewNFA()
-	e2End := NewNFA()
-	r.debugger.Enter("catExpr")
+	r.debugger.Enter("andExpr")
 
-	//判断起始字符是否合法
-	if r.firstInCat(r.lexReader.currentToken) {
-		start, end = r.factor(start, end)
+	node := r.catExpr()
+	if r.lexReader.Match(AND) {
+		intersect := &IntersectNode{Operands: []RegexNode{node}}
+		for r.lexReader.Match(AND) {
+			r.lexReader.Advance()
+			intersect.Operands = append(intersect.Operands, r.catExpr())
+		}
+		node = intersect
 	}
 
+	r.debugger.Leave("andExpr")
+
+	return node
+}
+
+func (r *RegParser) catExpr() RegexNode {
+	/*
+		cat_expr -> cat_expr | factor
+	*/
+	r.debugger.Enter("catExpr")
+
+	items := make([]RegexNode, 0)
 	for r.firstInCat(r.lexReader.currentToken) {
-		e2Start, e2End = r.factor(e2Start, e2End)
-		end.next = e2Start
-		end = e2End
+		items = append(items, r.factor())
 	}
 
 	r.debugger.Leave("catExpr")
-	return start, end
+
+	if len(items) == 1 {
+		return items[0]
+	}
+	return &ConcatNode{Items: items}
 }
 
 func (r *RegParser) firstInCat(tok TOKEN) bool {
 	switch tok {
 	case CLOSE_PARAN:
 		fallthrough
+	case MACRO_END:
+		fallthrough
+	case AND:
+		fallthrough
 	case AT_EOL:
 		fallthrough
 	case OR:
@@ -202,43 +305,69 @@ func (r *RegParser) firstInCat(tok TOKEN) bool {
 	return true
 }
 
-func (r *RegParser) factor(start *NFA, end *NFA) (newStart *NFA, newEnd *NFA) {
+func (r *RegParser) factor() RegexNode {
 	/*
-		factor -> term* | term+ | term?
+		factor -> ~factor | term* | term+ | term?
+		~作用于整个factor, 例如 ~a* 等价于 ~(a*)
 	*/
 	r.debugger.Enter("factor")
-	var e2Start *NFA
-	var e2End *NFA
-	start, end = r.term(start, end)
-	e2Start = start
-	e2End = end
-	if r.lexReader.Match(CLOSURE) || r.lexReader.Match(PLUS_CLOSE) || r.lexReader.Match(OPTIONAL) {
-		e2Start = NewNFA()
-		e2End = NewNFA()
-		e2Start.next = start
-		end.next = e2End
-
-		if r.lexReader.Match(CLOSURE) || r.lexReader.Match(OPTIONAL) {
-			//匹配操作符*,+,创建一条epsilon边直接连接头尾
-			e2Start.next2 = e2End
-		}
+	if r.lexReader.Match(COMPLEMENT) {
+		r.lexReader.Advance()
+		node := &ComplementNode{Body: r.factor()}
+		r.debugger.Leave("factor")
+		return node
+	}
+	node := r.classExpr()
+	if r.lexReader.Match(CLOSURE) {
+		node = &StarNode{Body: node}
+		r.lexReader.Advance()
+	} else if r.lexReader.Match(PLUS_CLOSE) {
+		node = &PlusNode{Body: node}
+		r.lexReader.Advance()
+	} else if r.lexReader.Match(OPTIONAL) {
+		node = &OptNode{Body: node}
+		r.lexReader.Advance()
+	}
+	r.debugger.Leave("factor")
+	return node
+}
 
-		if r.lexReader.Match(CLOSURE) || r.lexReader.Match(PLUS_CLOSE) {
-			//匹配操作符*,?，创建一条epsilon边连接尾部和头部
-			end.next2 = start
+func (r *RegParser) classExpr() RegexNode {
+	/*
+		class_expr -> class_expr {-} term | class_expr {+} term | term
+		例如 [a-z]{-}[aeiou] 表示除元音外的小写字母，{LETTER}{+}[_] 表示字母或下划线,
+		运算从左到右进行，两边都必须是字符集，宏定义展开后是字符集也可以
+	*/
+	node := r.term()
+	for r.lexReader.Match(CCL_DIFF) || r.lexReader.Match(CCL_UNION) {
+		union := r.lexReader.Match(CCL_UNION)
+		r.lexReader.Advance()
+		left := classSet(node)
+		right := classSet(r.term())
+		if left == nil || right == nil {
+			r.parseErr.ParseErr(E_CLASSOP)
 		}
 
-		r.lexReader.Advance()
+		set := make(map[string]bool)
+		for i := 0; i < ASCII_CHAR_NUM; i++ {
+			key := string(rune(i))
+			if union {
+				set[key] = left[key] || right[key]
+			} else {
+				set[key] = left[key] && !right[key]
+			}
+		}
+		node = &CharClassNode{Set: set}
 	}
-	r.debugger.Leave("factor")
-	return e2Start, e2End
+
+	return node
 }
 
 func (r *RegParser) printCCL(set map[string]bool) {
 	//输出字符集的内容
 	s := fmt.Sprintf("%s", "[")
 	for i := 0; i <= 127; i++ {
-		selected, ok := set[string(i)]
+		selected, ok := set[string(rune(i))]
 		if !ok {
 			continue
 		}
@@ -249,9 +378,9 @@ func (r *RegParser) printCCL(set map[string]bool) {
 
 		if i < int(' ') {
 			//控制字符
-			s += fmt.Sprintf("^%s", string(i+int('@')))
+			s += fmt.Sprintf("^%s", string(rune(i+int('@'))))
 		} else {
-			s += fmt.Sprintf("%s", string(i))
+			s += fmt.Sprintf("%s", string(rune(i)))
 		}
 	}
 
@@ -306,9 +435,11 @@ func (r *RegParser) printEdge(node *NFA) {
 		r.printCCL(node.bitset)
 	case EPSILON:
 		fmt.Println("EPSILON")
+	case BOL:
+		fmt.Println("BOL")
 	default:
 		//匹配单个字符
-		fmt.Printf("%s\n", string(node.edge))
+		fmt.Printf("%s\n", string(rune(node.edge)))
 	}
 }
 
@@ -317,101 +448,176 @@ func (r *RegParser) doDash(set map[string]bool) {
 	for !r.lexReader.Match(EOS) && !r.lexReader.Match(CCL_END) {
 		if !r.lexReader.Match(DASH) {
 			first = r.lexReader.Lexeme
-			set[string(r.lexReader.Lexeme)] = true
+			set[string(rune(r.lexReader.Lexeme))] = true
 		} else {
 			r.lexReader.Advance() //越过 '-'
 			for ; first <= r.lexReader.Lexeme; first++ {
-				set[string(first)] = true
+				set[string(rune(first))] = true
 			}
 		}
 		r.lexReader.Advance()
 	}
 }
 
-func (r *RegParser) term(start *NFA, end *NFA) (newStart *NFA, newEnd *NFA) {
+func (r *RegParser) isCaseless() bool {
+	//全局的 %option caseless 或者处于 (?i:...) 内部时都要忽略大小写
+	return r.lexReader.Options.Caseless || r.caselessDepth > 0
+}
+
+func (r *RegParser) otherCase(c int) int {
+	//返回字母对应的另一种大小写形式，非字母返回-1
+	if 'a' <= c && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+
+	if 'A' <= c && c <= 'Z' {
+		return c - 'A' + 'a'
+	}
+
+	return -1
+}
+
+func (r *RegParser) foldCase(set map[string]bool) {
+	//把字符集中每个字母对应的另一种大小写形式也加入字符集
+	for i := 0; i < ASCII_CHAR_NUM; i++ {
+		if !set[string(rune(i))] {
+			continue
+		}
+
+		if other := r.otherCase(i); other != -1 {
+			set[string(rune(other))] = true
+		}
+	}
+}
+
+func (r *RegParser) inlineFlags() {
 	/*
-		term -> [...] | [^...] | [] | [^] | . | (expr) | <character>
+		当前读到 "(?", 接下来必须是 "i:", 也就是 (?i:expr) 的形式
+	*/
+	r.lexReader.Advance() //越过 '?'
+	if !r.lexReader.Match(L) || r.lexReader.Lexeme != int('i') {
+		r.parseErr.ParseErr(E_BADREXPR)
+	}
+	r.lexReader.Advance()
+	if !r.lexReader.Match(L) || r.lexReader.Lexeme != int(':') {
+		r.parseErr.ParseErr(E_BADREXPR)
+	}
+	r.lexReader.Advance()
+}
+
+func (r *RegParser) term() RegexNode {
+	/*
+		term -> [...] | [^...] | [] | [^] | . | (expr) | (?i:expr) | {macro} | <character>
 		[] 匹配空格，回车，换行，但不匹配\r
 	*/
 	r.debugger.Enter("term")
+	var node RegexNode
 
 	if r.lexReader.Match(OPEN_PAREN) {
 		//匹配(expr)
 		r.lexReader.Advance()
-		start, end = r.expr(start, end)
+		caselessGroup := false
+		if r.lexReader.Match(OPTIONAL) {
+			//匹配(?i:expr), 括号内的表达式忽略大小写
+			r.inlineFlags()
+			caselessGroup = true
+			r.caselessDepth += 1
+		}
+		node = r.expr()
+		if caselessGroup {
+			r.caselessDepth -= 1
+		}
 		if r.lexReader.Match(CLOSE_PARAN) {
 			r.lexReader.Advance()
 		} else {
 			//没有右括号
 			r.parseErr.ParseErr(E_PAREN)
 		}
+	} else if r.lexReader.Match(MACRO_START) {
+		//宏定义展开后的内容相当于被括号包裹
+		name, args := r.lexReader.MacroName, r.lexReader.MacroArgs
+		r.lexReader.Advance()
+		node = &MacroNode{Name: name, Args: args, Body: r.expr()}
+		if r.lexReader.Match(MACRO_END) {
+			r.lexReader.Advance()
+		} else {
+			r.parseErr.ParseErr(E_BADMAC)
+		}
+	} else if !(r.lexReader.Match(ANY) || r.lexReader.Match(CCL_START)) {
+		//匹配单字符
+		node = &LiteralNode{Char: r.lexReader.Lexeme}
+		if other := r.otherCase(r.lexReader.Lexeme); other != -1 && r.isCaseless() {
+			//忽略大小写时字母要变成包含大小写两种形式的字符集
+			set := make(map[string]bool)
+			set[string(rune(r.lexReader.Lexeme))] = true
+			set[string(rune(other))] = true
+			node = &CharClassNode{Set: set}
+		}
+		r.lexReader.Advance()
 	} else {
-		start = NewNFA()
-		end = NewNFA()
-		start.next = end
-
-		if !(r.lexReader.Match(ANY) || r.lexReader.Match(CCL_START)) {
-			//匹配单字符
-			start.edge = EdgeType(r.lexReader.Lexeme)
+		/*
+			匹配 "." 本质上是匹配字符集，集合里面包含所有除了\r, \n 之外的ASCII字符
+		*/
+		set := make(map[string]bool)
+		if r.lexReader.Match(ANY) {
+			for i := 0; i < ASCII_CHAR_NUM; i++ {
+				if i != int('\r') && i != int('\n') {
+					set[string(rune(i))] = true
+				}
+			}
 			r.lexReader.Advance()
 		} else {
 			/*
-				匹配 "." 本质上是匹配字符集，集合里面包含所有除了\r, \n 之外的ASCII字符
+				匹配由中括号形成的字符集
 			*/
-			start.edge = CCL
-			if r.lexReader.Match(ANY) {
-				for i := 0; i < ASCII_CHAR_NUM; i++ {
-					if i != int('\r') && i != int('\n') {
-						start.bitset[string(i)] = true
-					}
+			r.lexReader.Advance() //越过'['
+			negativeClass := false
+			if r.lexReader.Match(AT_BOL) {
+				/*
+					[^...] 匹配字符集取反
+
+				*/
+				set[string('\n')] = false
+				set[string('\r')] = false
+				negativeClass = true
+				r.lexReader.Advance() //越过 '^'
+			}
+			if !r.lexReader.Match(CCL_END) {
+				/*
+					匹配类似[a-z]这样的字符集
+				*/
+				r.doDash(set)
+				if r.isCaseless() {
+					//必须在取反之前扩展大小写，这样[^a]才会同时排除a和A
+					r.foldCase(set)
 				}
 			} else {
 				/*
-					匹配由中括号形成的字符集
+					匹配 【】 或 [^]
 				*/
-				r.lexReader.Advance() //越过'['
-				negativeClass := false
-				if r.lexReader.Match(AT_BOL) {
-					/*
-						[^...] 匹配字符集取反
-
-					*/
-					start.bitset[string('\n')] = false
-					start.bitset[string('\r')] = false
-					negativeClass = true
-				}
-				if !r.lexReader.Match(CCL_END) {
-					/*
-						匹配类似[a-z]这样的字符集
-					*/
-					r.doDash(start.bitset)
-				} else {
-					/*
-						匹配 【】 或 [^]
-					*/
-					for c := 0; c <= int(' '); c++ {
-						start.bitset[string(c)] = true
-					}
+				for c := 0; c <= int(' '); c++ {
+					set[string(rune(c))] = true
 				}
+			}
 
-				if negativeClass {
-					for key, _ := range start.bitset {
-						start.bitset[key] = false
-					}
+			if negativeClass {
+				for key := range set {
+					set[key] = false
+				}
 
-					for i := 0; i <= 127; i++ {
-						_, ok := start.bitset[string(i)]
-						if !ok {
-							start.bitset[string(i)] = true
-						}
+				for i := 0; i <= 127; i++ {
+					_, ok := set[string(rune(i))]
+					if !ok {
+						set[string(rune(i))] = true
 					}
 				}
-
-				r.lexReader.Advance() //越过 ']'
 			}
+
+			r.lexReader.Advance() //越过 ']'
 		}
+		node = &CharClassNode{Set: set}
 	}
 
 	r.debugger.Leave("term")
-	return start, end
+	return node
 }
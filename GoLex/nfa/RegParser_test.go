@@ -0,0 +1,199 @@
+package nfa
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestParser(t *testing.T, spec string) *RegParser {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.lex")
+	require.Nil(t, os.WriteFile(input, []byte(spec), 0644))
+	lexReader, err := NewLexReader(input, filepath.Join(dir, "output.py"))
+	require.Nil(t, err)
+	lexReader.Head()
+	parser, _ := NewRegParser(lexReader)
+	return parser
+}
+
+func parseSpec(t *testing.T, spec string) *NFA {
+	return newTestParser(t, spec).Parse()
+}
+
+func parseRules(t *testing.T, spec string) []*Rule {
+	return newTestParser(t, spec).ParseAST()
+}
+
+func TestCaselessOption(t *testing.T) {
+	start := parseSpec(t, "%option caseless\n%%\nselect[a-c] return 1\n")
+	require.True(t, NfaMatchString(start, "SeLeCtB"))
+	require.True(t, NfaMatchString(start, "selecta"))
+	require.False(t, NfaMatchString(start, "selectd"))
+}
+
+func TestInlineCaselessGroup(t *testing.T) {
+	start := parseSpec(t, "%%\n(?i:if)x return 1\n")
+	require.True(t, NfaMatchString(start, "IFx"))
+	require.True(t, NfaMatchString(start, "iFx"))
+	require.False(t, NfaMatchString(start, "IFX"))
+}
+
+func TestCaselessNegativeClass(t *testing.T) {
+	start := parseSpec(t, "%option caseless\n%%\n[^a]b return 1\n")
+	require.False(t, NfaMatchString(start, "Ab"))
+	require.True(t, NfaMatchString(start, "cB"))
+}
+
+func TestParseAST(t *testing.T) {
+	rules := parseRules(t, "D [0-9]\n%%\n({D}*\\.{D}|{D}\\.{D}*) return FCON\n")
+	require.Equal(t, 1, len(rules))
+	require.Equal(t, "{D}*\\.{D}|{D}\\.{D}*", rules[0].Regex.String())
+	require.Equal(t, "return FCON", rules[0].Action)
+
+	alt, ok := rules[0].Regex.(*AltNode)
+	require.True(t, ok)
+	require.Equal(t, 2, len(alt.Branches))
+	macro := alt.Branches[1].(*ConcatNode).Items[0].(*MacroNode)
+	require.Equal(t, "D", macro.Name)
+	require.Equal(t, "[0-9]", macro.Body.String())
+}
+
+func TestASTPrintRoundTrip(t *testing.T) {
+	rules := parseRules(t, "%%\n^(ab|[^a-z\\]])+\"x y\"?.\\t$ return 1\n")
+	printed := rules[0].Regex.String()
+	require.Equal(t, "^(ab|[^\\]a-z])+x\\sy?.\\t$", printed)
+
+	again := parseRules(t, "%%\n"+printed+" return 1\n")
+	require.Equal(t, printed, again[0].Regex.String())
+}
+
+func TestASTPrintMacroArgs(t *testing.T) {
+	//带参数的宏定义调用要连同参数一起输出，否则重新解析时参数个数不对
+	defs := "QUOTED(q)  {q}([^{q}\\\\]|\\\\.)*{q}\nPAIR(a,b)  {a}{b}\nD  [0-9]\n%%\n"
+	rules := parseRules(t, defs+"{QUOTED(\")}{PAIR(x,{D})}{D} return 1\n")
+	printed := rules[0].Regex.String()
+	require.Equal(t, "{QUOTED(\")}{PAIR(x,{D})}{D}", printed)
+
+	again := parseRules(t, defs+printed+" return 1\n")
+	require.Equal(t, printed, again[0].Regex.String())
+}
+
+func TestMacroIsGrouped(t *testing.T) {
+	start := parseSpec(t, "AB ab\n%%\n{AB}+ return 1\n")
+	require.True(t, NfaMatchString(start, "abab"))
+	require.False(t, NfaMatchString(start, "abb"))
+}
+
+func TestClassDifference(t *testing.T) {
+	rules := parseRules(t, "%%\n[a-z]{-}[aeiou] return 1\n")
+	require.Equal(t, "[b-df-hj-np-tv-z]", rules[0].Regex.String())
+}
+
+func TestClassUnionWithMacro(t *testing.T) {
+	rules := parseRules(t, "LETTER [a-zA-Z]\n%%\n({LETTER}{+}[_])+ return 1\n")
+	require.Equal(t, "[A-Z_a-z]+", rules[0].Regex.String())
+}
+
+func TestClassOperatorsLeftToRight(t *testing.T) {
+	rules := parseRules(t, "%%\n[a-c]{+}[x]{-}[a] return 1\n")
+	require.Equal(t, "[bcx]", rules[0].Regex.String())
+}
+
+func TestClassOperatorNeedsClass(t *testing.T) {
+	require.Panics(t, func() { parseRules(t, "%%\n(ab){-}[a] return 1\n") })
+}
+
+func TestNullableRule(t *testing.T) {
+	defer func() {
+		err := recover()
+		require.NotNil(t, err)
+		require.Contains(t, err, "Rule matches the empty string: ")
+		require.Contains(t, err, "input.lex:4: rule 1 {D}*, use %option allowempty to accept it")
+	}()
+
+	require.True(t, Nullable(parseRules(t, "%option allowempty\n%%\n(a?|b)c*   {}\n")[0].Regex))
+	require.False(t, Nullable(parseRules(t, "%%\n(a?|b)c+   {}\n")[0].Regex))
+	require.False(t, Nullable(parseRules(t, "%%\n~(a*)   {}\n")[0].Regex))
+	require.False(t, Nullable(parseRules(t, "%%\na*&b+   {}\n")[0].Regex))
+	parseRules(t, "D  [0-9]\n%%\n{D}+   {}\n{D}*   {}\n%%\n")
+}
+
+func TestStartConditions(t *testing.T) {
+	parser := newTestParser(t, "%s MAYBE\n%x STR\n%%\na   {}\n<STR>b   {}\n<MAYBE,STR>c   {}\n<*>d   {}\n<<EOF>>   { done(); }\n<STR><<EOF>>   {}\n%%\n")
+	rules := parser.ParseAST()
+	conditions := parser.lexReader.StartConditions
+	require.Equal(t, []*StartCondition{{Name: INITIAL}, {Name: "MAYBE"}, {Name: "STR", Exclusive: true}}, conditions)
+	require.Equal(t, 4, len(rules))
+	require.Equal(t, []string{"a", "b", "c", "d"}, []string{rules[0].Name, rules[1].Name, rules[2].Name, rules[3].Name})
+	require.Equal(t, []int{0, 1, 2}, rules[3].StartConditions)
+
+	active := func(rule *Rule) []bool {
+		return []bool{rule.ActiveIn(0, conditions), rule.ActiveIn(1, conditions), rule.ActiveIn(2, conditions)}
+	}
+	require.Equal(t, []bool{true, true, false}, active(rules[0]))
+	require.Equal(t, []bool{false, false, true}, active(rules[1]))
+	require.Equal(t, []bool{false, true, true}, active(rules[2]))
+
+	eofRules := parser.lexReader.EOFRules
+	require.Equal(t, 2, len(eofRules))
+	require.Equal(t, "{ done(); }", eofRules[0].Action)
+	require.Equal(t, "<<EOF>>", eofRules[1].Name)
+	require.Equal(t, eofRules[0], eofRuleFor(eofRules, 1))
+	require.Equal(t, eofRules[1], eofRuleFor(eofRules, 2))
+}
+
+func TestStartConditionErrors(t *testing.T) {
+	func() {
+		defer func() {
+			err := recover()
+			require.NotNil(t, err)
+			require.Contains(t, err, "Undeclared start condition: ")
+			require.Contains(t, err, "input.lex:2: <NOPE>")
+		}()
+		parseRules(t, "%%\n<NOPE>a   {}\n")
+	}()
+	require.Panics(t, func() { newTestParser(t, "%s A\n%x A\n%%\na   {}\n") })
+	require.Panics(t, func() { newTestParser(t, "%%\n<<EOF>>x   {}\n").ParseAST() })
+	//不是合法开始条件列表的<是普通字符
+	require.Equal(t, "<1>", parseRules(t, "%%\n<1>   {}\n")[0].Name)
+}
+
+func TestTokenDeclarations(t *testing.T) {
+	parser := newTestParser(t, "%token FCON = 10\n%token ICON STRING=3 NAME\n%%\n[0-9]+   => ICON\n<<EOF>>   => NAME\n%%\n")
+	rules := parser.ParseAST()
+	tokens := parser.lexReader.Tokens
+	require.Equal(t, []*TokenDecl{{"FCON", 10}, {"ICON", 11}, {"STRING", 3}, {"NAME", 4}}, tokens)
+	require.Equal(t, "=> ICON", rules[0].Action)
+	require.Equal(t, "return NAME", tokenActionBody(parser.lexReader.EOFRules[0].Action, "return %s"))
+
+	func() {
+		defer func() {
+			err := recover()
+			require.NotNil(t, err)
+			require.Contains(t, err, "Undeclared token: ")
+			require.Contains(t, err, "input.lex:3: => NOPE")
+		}()
+		parseRules(t, "%token A\n%%\na   => NOPE\n")
+	}()
+	require.Panics(t, func() { newTestParser(t, "%token A A\n%%\na   {}\n") })
+	require.Panics(t, func() { newTestParser(t, "%x A\n%token A\n%%\na   {}\n") })
+	require.Panics(t, func() { newTestParser(t, "%token A = 0\n%%\na   {}\n") })
+	require.Panics(t, func() { newTestParser(t, "%token A =\n%%\na   {}\n") })
+}
+
+func TestParseErrorMessages(t *testing.T) {
+	//每个错误类型都有自己的信息，E_CLOSE之后的错误曾经因为缺少两条信息而错位
+	require.Equal(t, int(E_BADTOKEN)+1, len(NewParseError().err_msgs))
+	require.PanicsWithValue(t, "+ ? or * must follow an expression or subexpression", func() {
+		parseRules(t, "%%\n*a   {}\n")
+	})
+	require.PanicsWithValue(t, "Newline in quoted string, use \\n instead", func() {
+		parseRules(t, "%%\n\"ab   {}\n")
+	})
+	require.PanicsWithValue(t, "Macro doesn't exist", func() {
+		parseRules(t, "%%\n{NOPE}   {}\n")
+	})
+}
@@ -0,0 +1,332 @@
+package nfa
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+RegParser 先把正则表达式解析成语法树，然后再由AstNfaConverter把语法树转换成NFA状态机，
+这样我们可以在生成NFA之前查看，化简或者重新输出一条规则
+*/
+type RegexNode interface {
+	//把语法树重新输出成正则表达式字符串
+	String() string
+}
+
+type ConcatNode struct {
+	Items []RegexNode //前后连接的表达式, 没有元素时匹配空字符串
+}
+
+type AltNode struct {
+	Branches []RegexNode // a|b|c
+}
+
+type IntersectNode struct {
+	Operands []RegexNode // a&b, 同时被所有表达式匹配的字符串
+}
+
+type ComplementNode struct {
+	Body RegexNode // ~a, 所有不能被a匹配的字符串
+}
+
+type StarNode struct {
+	Body RegexNode // a*
+}
+
+type PlusNode struct {
+	Body RegexNode // a+
+}
+
+type OptNode struct {
+	Body RegexNode // a?
+}
+
+type CharClassNode struct {
+	Set map[string]bool //跟NFA节点的bitset一样，例如[A-Z]
+}
+
+type LiteralNode struct {
+	Char int //匹配单个字符
+}
+
+type AnchorNode struct {
+	Anchor Anchor //START对应^, END对应$
+}
+
+type MacroNode struct {
+	Name string    //宏定义名称，例如{D}中的D
+	Args []string  //调用时写的参数，例如{QUOTED(")}中的"，没有参数列表时为nil
+	Body RegexNode //宏定义展开后的表达式
+}
+
+type Rule struct {
+	Regex    RegexNode
+	Action   string //匹配后要执行的代码
+	Anchor   Anchor
+	Position string //规则在输入文件中的位置，格式为 文件名:行号
+	Name     string //规则名称，默认是规则中正则表达式部分的原文
+	//规则有效的开始条件，nil表示所有包含型开始条件，见StartCondition
+	StartConditions []int
+}
+
+// 下面的优先级用于决定输出表达式时是否需要加上括号
+const (
+	precAlt = iota
+	precIntersect
+	precConcat
+	precClosure
+	precAtom
+)
+
+func precedence(node RegexNode) int {
+	switch n := node.(type) {
+	case *AltNode:
+		return precAlt
+	case *IntersectNode:
+		return precIntersect
+	case *ConcatNode:
+		if len(n.Items) == 1 {
+			return precedence(n.Items[0])
+		}
+		return precConcat
+	case *StarNode, *PlusNode, *OptNode, *ComplementNode:
+		return precClosure
+	}
+
+	return precAtom
+}
+
+func wrapRegex(node RegexNode, prec int) string {
+	//如果子表达式的优先级比所在位置要求的低，那么要用括号包起来
+	s := node.String()
+	if precedence(node) < prec || s == "" {
+		return "(" + s + ")"
+	}
+
+	return s
+}
+
+func (c *ConcatNode) String() string {
+	s := ""
+	for _, item := range c.Items {
+		s += wrapRegex(item, precConcat)
+	}
+
+	return s
+}
+
+func (a *AltNode) String() string {
+	branches := make([]string, 0, len(a.Branches))
+	for _, branch := range a.Branches {
+		branches = append(branches, branch.String())
+	}
+
+	return strings.Join(branches, "|")
+}
+
+func (i *IntersectNode) String() string {
+	operands := make([]string, 0, len(i.Operands))
+	for _, operand := range i.Operands {
+		operands = append(operands, wrapRegex(operand, precIntersect+1))
+	}
+
+	return strings.Join(operands, "&")
+}
+
+func (c *ComplementNode) String() string {
+	return "~" + wrapRegex(c.Body, precClosure)
+}
+
+func (s *StarNode) String() string {
+	return wrapRegex(s.Body, precAtom) + "*"
+}
+
+func (p *PlusNode) String() string {
+	return wrapRegex(p.Body, precAtom) + "+"
+}
+
+func (o *OptNode) String() string {
+	return wrapRegex(o.Body, precAtom) + "?"
+}
+
+func (l *LiteralNode) String() string {
+	if l.Char == int('^') {
+		//\^会被当成控制字符的前缀，因此用16进制输出
+		return "\\x05e"
+	}
+
+	if strings.ContainsRune("$()*+-.?[]{|}&~\"\\", rune(l.Char)) {
+		return "\\" + string(rune(l.Char))
+	}
+
+	return escapeChar(l.Char)
+}
+
+func (a *AnchorNode) String() string {
+	if a.Anchor == END {
+		return "$"
+	}
+
+	return "^"
+}
+
+func (m *MacroNode) String() string {
+	if m.Args == nil {
+		return "{" + m.Name + "}"
+	}
+
+	return "{" + m.Name + "(" + strings.Join(m.Args, ",") + ")}"
+}
+
+func (r *Rule) String() string {
+	return r.Regex.String() + " " + strings.TrimSpace(r.Action)
+}
+
+func Nullable(node RegexNode) bool {
+	/*
+		判断表达式是否能匹配空字符串，例如 {D}* 或者 a?b?，
+		^ 和 $ 只检查位置，不消耗字符
+	*/
+	switch n := node.(type) {
+	case *ConcatNode:
+		for _, item := range n.Items {
+			if !Nullable(item) {
+				return false
+			}
+		}
+		return true
+	case *AltNode:
+		for _, branch := range n.Branches {
+			if Nullable(branch) {
+				return true
+			}
+		}
+		return false
+	case *IntersectNode:
+		for _, operand := range n.Operands {
+			if !Nullable(operand) {
+				return false
+			}
+		}
+		return true
+	case *ComplementNode:
+		return !Nullable(n.Body)
+	case *StarNode, *OptNode, *AnchorNode:
+		return true
+	case *PlusNode:
+		return Nullable(n.Body)
+	case *MacroNode:
+		return Nullable(n.Body)
+	}
+
+	return false
+}
+
+func escapeChar(c int) string {
+	/*
+		把不可见字符转换成LexReader.esc能够识别的转义形式，空格在表达式中表示结束，因此也要转义
+	*/
+	switch c {
+	case ' ':
+		return "\\s"
+	case '\b':
+		return "\\b"
+	case '\f':
+		return "\\f"
+	case '\n':
+		return "\\n"
+	case '\r':
+		return "\\r"
+	case '\t':
+		return "\\t"
+	case '\033':
+		return "\\e"
+	}
+
+	if c < int(' ') {
+		return "\\^" + string(rune(c+int('@')))
+	}
+
+	if c >= 127 {
+		return fmt.Sprintf("\\x%03x", c)
+	}
+
+	return string(rune(c))
+}
+
+func isDotSet(set map[string]bool) bool {
+	//判断字符集是否就是 "."，也就是除了\r, \n外的所有字符
+	for i := 0; i < MAX_CHARS; i++ {
+		if set[string(rune(i))] != (i != int('\r') && i != int('\n')) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *CharClassNode) String() string {
+	if isDotSet(c.Set) {
+		return "."
+	}
+
+	members := 0
+	for i := 0; i < MAX_CHARS; i++ {
+		if c.Set[string(rune(i))] {
+			members += 1
+		}
+	}
+
+	/*
+		如果字符集包含的字符超过一半，那么用[^...]的形式输出会更简短,
+		[^...]本身不包含\r和\n,所以取反输出时不需要把这两个字符列出来
+	*/
+	negative := members > MAX_CHARS/2 && !c.Set["\r"] && !c.Set["\n"]
+	s := "["
+	if negative {
+		s += "^"
+	}
+
+	for i := 0; i < MAX_CHARS; i++ {
+		if c.Set[string(rune(i))] == negative {
+			continue
+		}
+		if negative && (i == int('\r') || i == int('\n')) {
+			continue
+		}
+
+		//把连续的字符输出成a-z的形式
+		j := i
+		for j+1 < MAX_CHARS && c.Set[string(rune(j+1))] != negative {
+			j += 1
+		}
+
+		s += escapeClassChar(i)
+		if j > i+1 {
+			s += "-" + escapeClassChar(j)
+			i = j
+		}
+	}
+
+	return s + "]"
+}
+
+func escapeClassChar(c int) string {
+	if c == int('^') {
+		return "\\x05e"
+	}
+
+	if strings.ContainsRune("-][\"\\{", rune(c)) {
+		return "\\" + string(rune(c))
+	}
+
+	return escapeChar(c)
+}
+
+func PrintAST(rules []*Rule) {
+	fmt.Println("----------AST INFO------------")
+	for i, rule := range rules {
+		fmt.Printf("rule %d: %s\n", i, rule.String())
+	}
+}
@@ -0,0 +1,351 @@
+package nfa
+
+import "strings"
+
+/*
+在把语法树转换成NFA之前先对其进行化简，化简不会改变表达式所匹配的字符串集合，
+但可以减少NFA节点数，从而加快EpsilonClosure和MakeDTran的执行，目前支持如下化简:
+(a|b|c)   -> [abc]      单字符分支合并成字符集
+(x*)*     -> x*         嵌套的闭包合并
+a?a*      -> a*         相邻的闭包合并
+ab|ac     -> a(b|c)     提取分支的公共前缀
+a|b|a     -> a|b        去掉重复的分支
+*/
+type AstSimplifier struct {
+}
+
+func NewAstSimplifier() *AstSimplifier {
+	return &AstSimplifier{}
+}
+
+func (s *AstSimplifier) Simplify(rules []*Rule) []*Rule {
+	for _, rule := range rules {
+		rule.Regex = s.simplify(rule.Regex)
+	}
+
+	return rules
+}
+
+func (s *AstSimplifier) simplify(node RegexNode) RegexNode {
+	switch n := node.(type) {
+	case *ConcatNode:
+		return s.concat(n)
+	case *AltNode:
+		return s.alt(n)
+	case *StarNode:
+		body := s.simplify(n.Body)
+		if isEmptyRegex(body) {
+			return body
+		}
+		if inner := closureBody(body); inner != nil {
+			//(x*)*, (x+)*, (x?)* 都等价于 x*
+			return &StarNode{Body: inner}
+		}
+		return &StarNode{Body: body}
+	case *PlusNode:
+		body := s.simplify(n.Body)
+		switch b := body.(type) {
+		case *PlusNode:
+			return b
+		case *StarNode:
+			return b
+		case *OptNode:
+			return &StarNode{Body: b.Body}
+		}
+		return &PlusNode{Body: body}
+	case *OptNode:
+		body := s.simplify(n.Body)
+		switch b := body.(type) {
+		case *OptNode:
+			return b
+		case *StarNode:
+			return b
+		case *PlusNode:
+			return &StarNode{Body: b.Body}
+		}
+		if isEmptyRegex(body) {
+			return body
+		}
+		return &OptNode{Body: body}
+	case *MacroNode:
+		return &MacroNode{Name: n.Name, Args: n.Args, Body: s.simplify(n.Body)}
+	case *IntersectNode:
+		operands := make([]RegexNode, 0, len(n.Operands))
+		for _, operand := range n.Operands {
+			operands = append(operands, s.simplify(operand))
+		}
+		return &IntersectNode{Operands: operands}
+	case *ComplementNode:
+		body := s.simplify(n.Body)
+		if inner, ok := body.(*ComplementNode); ok {
+			//~~x 等价于 x
+			return inner.Body
+		}
+		return &ComplementNode{Body: body}
+	}
+
+	return node
+}
+
+func closureBody(node RegexNode) RegexNode {
+	switch n := node.(type) {
+	case *StarNode:
+		return n.Body
+	case *PlusNode:
+		return n.Body
+	case *OptNode:
+		return n.Body
+	}
+
+	return nil
+}
+
+func isEmptyRegex(node RegexNode) bool {
+	concat, ok := node.(*ConcatNode)
+	return ok && len(concat.Items) == 0
+}
+
+func sameRegex(a RegexNode, b RegexNode) bool {
+	return regexKey(a) == regexKey(b)
+}
+
+func regexKey(node RegexNode) string {
+	/*
+		按照语法树的结构生成比较用的字符串，宏定义用展开后的表达式代替，
+		因为同一个宏定义在不同的参数或者(?i:)下展开的内容不同，例如{Q(a)}和{Q(b)}
+	*/
+	switch n := node.(type) {
+	case *MacroNode:
+		return regexKey(n.Body)
+	case *ConcatNode:
+		if len(n.Items) == 1 {
+			return regexKey(n.Items[0])
+		}
+		return "(" + joinKeys(n.Items, "") + ")"
+	case *AltNode:
+		return "(" + joinKeys(n.Branches, "|") + ")"
+	case *IntersectNode:
+		return "(" + joinKeys(n.Operands, "&") + ")"
+	case *ComplementNode:
+		return "~(" + regexKey(n.Body) + ")"
+	case *StarNode:
+		return "(" + regexKey(n.Body) + ")*"
+	case *PlusNode:
+		return "(" + regexKey(n.Body) + ")+"
+	case *OptNode:
+		return "(" + regexKey(n.Body) + ")?"
+	}
+
+	//字符，字符集和锚点输出的字符串就能区分不同的节点
+	return node.String()
+}
+
+func joinKeys(nodes []RegexNode, sep string) string {
+	keys := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		keys = append(keys, regexKey(node))
+	}
+
+	return strings.Join(keys, sep)
+}
+
+func (s *AstSimplifier) concat(n *ConcatNode) RegexNode {
+	items := make([]RegexNode, 0, len(n.Items))
+	for _, item := range n.Items {
+		item = s.simplify(item)
+		if inner, ok := item.(*ConcatNode); ok {
+			//嵌套的连接直接展开，空表达式也就被去掉了
+			items = append(items, inner.Items...)
+			continue
+		}
+
+		if len(items) > 0 {
+			if merged := mergeClosures(items[len(items)-1], item); merged != nil {
+				items[len(items)-1] = merged
+				continue
+			}
+		}
+		items = append(items, item)
+	}
+
+	if len(items) == 1 {
+		return items[0]
+	}
+
+	return &ConcatNode{Items: items}
+}
+
+func mergeClosures(first RegexNode, second RegexNode) RegexNode {
+	/*
+		合并相邻的两个闭包，返回nil表示不能合并:
+		x?x* x*x? x*x* -> x*
+		xx* x*x x+x* x*x+ -> x+
+	*/
+	firstBody := closureBody(first)
+	secondBody := closureBody(second)
+	_, firstStar := first.(*StarNode)
+	_, secondStar := second.(*StarNode)
+
+	if firstStar && secondBody != nil && sameRegex(firstBody, secondBody) {
+		if _, ok := second.(*PlusNode); ok {
+			return second
+		}
+		return first
+	}
+
+	if secondStar && firstBody != nil && sameRegex(firstBody, secondBody) {
+		if _, ok := first.(*PlusNode); ok {
+			return first
+		}
+		return second
+	}
+
+	if secondStar && sameRegex(first, secondBody) {
+		return &PlusNode{Body: first}
+	}
+
+	if firstStar && sameRegex(firstBody, second) {
+		return &PlusNode{Body: second}
+	}
+
+	return nil
+}
+
+func classSet(node RegexNode) map[string]bool {
+	//如果节点只匹配单个字符，那么返回它对应的字符集，否则返回nil
+	switch n := node.(type) {
+	case *LiteralNode:
+		return map[string]bool{string(rune(n.Char)): true}
+	case *CharClassNode:
+		return n.Set
+	case *MacroNode:
+		return classSet(n.Body)
+	}
+
+	return nil
+}
+
+func concatItems(node RegexNode) []RegexNode {
+	if concat, ok := node.(*ConcatNode); ok {
+		return concat.Items
+	}
+
+	return []RegexNode{node}
+}
+
+func (s *AstSimplifier) alt(n *AltNode) RegexNode {
+	branches := make([]RegexNode, 0, len(n.Branches))
+	seen := make(map[string]bool)
+	var class *CharClassNode
+	hasEmpty := false
+
+	var addBranch func(branch RegexNode)
+	addBranch = func(branch RegexNode) {
+		if inner, ok := branch.(*AltNode); ok {
+			for _, b := range inner.Branches {
+				addBranch(b)
+			}
+			return
+		}
+
+		if isEmptyRegex(branch) {
+			hasEmpty = true
+			return
+		}
+
+		if set := classSet(branch); set != nil {
+			//单字符的分支全部合并到一个字符集里
+			if class == nil {
+				class = &CharClassNode{Set: make(map[string]bool)}
+				branches = append(branches, class)
+			}
+			for key, val := range set {
+				if val {
+					class.Set[key] = true
+				}
+			}
+			return
+		}
+
+		key := regexKey(branch)
+		if seen[key] {
+			//重复的分支直接丢弃
+			return
+		}
+		seen[key] = true
+		branches = append(branches, branch)
+	}
+
+	for _, branch := range n.Branches {
+		addBranch(s.simplify(branch))
+	}
+
+	if class != nil {
+		//合并后只剩一个字符的字符集还原成单个字符
+		members := make([]int, 0)
+		for i := 0; i < ASCII_CHAR_NUM && len(members) < 2; i++ {
+			if class.Set[string(rune(i))] {
+				members = append(members, i)
+			}
+		}
+		if len(members) == 1 {
+			for i := range branches {
+				if branches[i] == RegexNode(class) {
+					branches[i] = &LiteralNode{Char: members[0]}
+				}
+			}
+		}
+	}
+
+	branches = s.factorPrefixes(branches)
+
+	var node RegexNode
+	if len(branches) == 0 {
+		return &ConcatNode{Items: []RegexNode{}}
+	} else if len(branches) == 1 {
+		node = branches[0]
+	} else {
+		node = &AltNode{Branches: branches}
+	}
+
+	if hasEmpty {
+		//a|ε 等价于 a?
+		return s.simplify(&OptNode{Body: node})
+	}
+
+	return node
+}
+
+func (s *AstSimplifier) factorPrefixes(branches []RegexNode) []RegexNode {
+	/*
+		把第一个元素相同的分支合并，例如ab|c|ad 变成a(b|d)|c，
+		分支的先后顺序不影响表达式匹配的字符串集合
+	*/
+	result := make([]RegexNode, 0, len(branches))
+	used := make([]bool, len(branches))
+	for i, branch := range branches {
+		if used[i] {
+			continue
+		}
+
+		items := concatItems(branch)
+		rests := []RegexNode{&ConcatNode{Items: items[1:]}}
+		for j := i + 1; j < len(branches); j++ {
+			other := concatItems(branches[j])
+			if !used[j] && sameRegex(items[0], other[0]) {
+				used[j] = true
+				rests = append(rests, &ConcatNode{Items: other[1:]})
+			}
+		}
+
+		if len(rests) == 1 {
+			result = append(result, branch)
+			continue
+		}
+
+		factored := &ConcatNode{Items: []RegexNode{items[0], &AltNode{Branches: rests}}}
+		result = append(result, s.simplify(factored))
+	}
+
+	return result
+}
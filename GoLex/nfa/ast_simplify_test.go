@@ -0,0 +1,86 @@
+package nfa
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func acceptsString(start *NFA, str string) bool {
+	//不打印中间过程的NFA匹配，用于比较两个NFA接收的字符串集合
+	states := EpsilonClosure([]*NFA{start})
+	for _, c := range str {
+		next := move(states.results, int(c))
+		if len(next) == 0 {
+			return false
+		}
+		states = EpsilonClosure(next)
+	}
+
+	return states.hasAccepted
+}
+
+func allStrings(alphabet string, maxLen int) []string {
+	result := []string{""}
+	last := []string{""}
+	for i := 0; i < maxLen; i++ {
+		next := make([]string, 0)
+		for _, prefix := range last {
+			for _, c := range alphabet {
+				next = append(next, prefix+string(c))
+			}
+		}
+		result = append(result, next...)
+		last = next
+	}
+
+	return result
+}
+
+func TestSimplifyRewrites(t *testing.T) {
+	cases := map[string]string{
+		"(a|b|c)":     "[a-c]",
+		"(x*)*":       "x*",
+		"(x+)?":       "x*",
+		"a?a*":        "a*",
+		"aa*":         "a+",
+		"(ab|ac)":     "a[bc]",
+		"(ab|c|ab)":   "ab|c",
+		"(abc|abd|a)": "a(b[cd])?",
+	}
+
+	for regex, expected := range cases {
+		rules := parseRules(t, "%option allowempty\n%%\n"+regex+" return 1\n")
+		require.Equal(t, expected, rules[0].Regex.String(), regex)
+	}
+}
+
+func TestSimplifyPreservesLanguage(t *testing.T) {
+	regexes := []string{
+		"(a|b|c)",
+		"(a*)*b",
+		"(a+)+|(b?)*",
+		"a?a*b*b",
+		"(ab|ac|a)c*",
+		"(ab|ba|ab)(a|)",
+		"((a|b)c|ac)*",
+		"(a*|b)+c?",
+		//宏定义的参数和忽略大小写都会改变展开后的表达式
+		"{Q(a)}|{Q(b)}",
+		"(?i:{K}){K}*",
+	}
+
+	defs := "Q(q)  {q}x{q}\nK  K\n"
+	inputs := allStrings("abcxKk", 5)
+	for _, regex := range regexes {
+		spec := defs + "%option allowempty\n%%\n" + regex + " return 1\n"
+		parser := newTestParser(t, spec)
+		parser.Simplify = false
+		original := parser.Parse()
+		simplified := parseSpec(t, spec)
+		for _, input := range inputs {
+			require.Equal(t, acceptsString(original, input), acceptsString(simplified, input),
+				"regex %s on input %q", regex, input)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package nfa
+
+type AstNfaConverter struct {
+}
+
+func NewAstNfaConverter() *AstNfaConverter {
+	return &AstNfaConverter{}
+}
+
+func (a *AstNfaConverter) MakeNFA(rules []*Rule) *NFA {
+	/*
+		每条规则对应一个NFA片段，所有片段的起始节点通过epsilon边串联起来:
+		start -> rule0
+		  |
+		  +--> node -> rule1
+		         |
+		         +--> node -> rule2 ...
+	*/
+	var p *NFA
+	var start *NFA
+
+	for i, rule := range rules {
+		if start == nil {
+			start = NewNFA()
+			p = start
+		} else {
+			p.next2 = NewNFA()
+			p = p.next2
+		}
+		p.next = a.rule(rule, i)
+	}
+
+	return start
+}
+
+func (a *AstNfaConverter) MakeNFAs(rules []*Rule, conditions []*StartCondition) []*NFA {
+	/*
+		每个开始条件对应一个起始节点，起始节点只串联在该开始条件下有效的规则，
+		规则的NFA片段只构造一次，由所有开始条件共用，因此同一条规则在不同开始条件下对应同样的接收节点
+	*/
+	fragments := make([]*NFA, len(rules))
+	for i, rule := range rules {
+		fragments[i] = a.rule(rule, i)
+	}
+
+	starts := make([]*NFA, len(conditions))
+	for c := range conditions {
+		var p *NFA
+		for i, rule := range rules {
+			if !rule.ActiveIn(c, conditions) {
+				continue
+			}
+			if starts[c] == nil {
+				starts[c] = NewNFA()
+				p = starts[c]
+			} else {
+				p.next2 = NewNFA()
+				p = p.next2
+			}
+			p.next = fragments[i]
+		}
+
+		if starts[c] == nil {
+			//没有任何规则的开始条件使用一个不接收任何字符的起始节点，next为nil的节点会被当作接收节点
+			starts[c] = NewNFA()
+			starts[c].edge = CCL
+			starts[c].next = NewNFA()
+		}
+	}
+
+	return starts
+}
+
+func (a *AstNfaConverter) rule(rule *Rule, index int) *NFA {
+	start, end := a.node(rule.Regex)
+	end.accept = rule.Action
+	end.anchor = rule.Anchor
+	end.rule = index
+	return start
+}
+
+func (a *AstNfaConverter) node(node RegexNode) (start *NFA, end *NFA) {
+	//根据语法树节点类型构造对应的NFA片段，返回片段的起始节点和结束节点
+	switch n := node.(type) {
+	case *ConcatNode:
+		return a.concat(n)
+	case *AltNode:
+		return a.alt(n)
+	case *StarNode:
+		return a.closure(n.Body, true, true)
+	case *PlusNode:
+		return a.closure(n.Body, false, true)
+	case *OptNode:
+		return a.closure(n.Body, true, false)
+	case *MacroNode:
+		return a.node(n.Body)
+	case *LiteralNode:
+		start = NewNFA()
+		end = NewNFA()
+		start.next = end
+		start.edge = EdgeType(n.Char)
+		return start, end
+	case *CharClassNode:
+		start = NewNFA()
+		end = NewNFA()
+		start.next = end
+		start.edge = CCL
+		for key, val := range n.Set {
+			start.bitset[key] = val
+		}
+		return start, end
+	case *AnchorNode:
+		return a.anchor(n)
+	case *IntersectNode:
+		dfa := a.subDFA(n.Operands[0])
+		for _, operand := range n.Operands[1:] {
+			dfa = mustDFA(intersectDFA(dfa, a.subDFA(operand)))
+		}
+		return dfa.toNFA()
+	case *ComplementNode:
+		return mustDFA(complementDFA(a.subDFA(n.Body))).toNFA()
+	}
+
+	panic("unknown regex node")
+}
+
+func (a *AstNfaConverter) subDFA(node RegexNode) *tableDFA {
+	//把子表达式单独转换成NFA片段，片段的结束节点没有后续节点，因此就是唯一的接收节点
+	start, _ := a.node(node)
+	return mustDFA(subsetDFA(start))
+}
+
+func mustDFA(dfa *tableDFA, err error) *tableDFA {
+	//规则的DFA超过DFA_MAX时和MakeDTran一样无法继续生成扫描器
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return dfa
+}
+
+func (a *AstNfaConverter) concat(n *ConcatNode) (start *NFA, end *NFA) {
+	if len(n.Items) == 0 {
+		//空表达式只需要一个节点，它直接就是结束节点
+		start = NewNFA()
+		return start, start
+	}
+
+	start, end = a.node(n.Items[0])
+	for _, item := range n.Items[1:] {
+		e2Start, e2End := a.node(item)
+		end.next = e2Start
+		end = e2End
+	}
+
+	return start, end
+}
+
+func (a *AstNfaConverter) alt(n *AltNode) (start *NFA, end *NFA) {
+	start, end = a.node(n.Branches[0])
+	for _, branch := range n.Branches[1:] {
+		e2Start, e2End := a.node(branch)
+		p := NewNFA()
+		p.next2 = e2Start
+		p.next = start
+		start = p
+
+		p = NewNFA()
+		end.next = p
+		e2End.next = p
+		end = p
+	}
+
+	return start, end
+}
+
+func (a *AstNfaConverter) closure(body RegexNode, skip bool, repeat bool) (start *NFA, end *NFA) {
+	/*
+		skip为true时创建一条epsilon边直接连接头尾，对应操作符*,?
+		repeat为true时创建一条epsilon边连接尾部和头部，对应操作符*,+
+	*/
+	bodyStart, bodyEnd := a.node(body)
+	start = NewNFA()
+	end = NewNFA()
+	start.next = bodyStart
+	bodyEnd.next = end
+
+	if skip {
+		start.next2 = end
+	}
+
+	if repeat {
+		bodyEnd.next2 = bodyStart
+	}
+
+	return start, end
+}
+
+func (a *AstNfaConverter) anchor(n *AnchorNode) (start *NFA, end *NFA) {
+	start = NewNFA()
+	end = NewNFA()
+	start.next = end
+	if n.Anchor == START {
+		/*
+			^ 必须在行首匹配，它对应的边不消耗字符，只有从行首对应的DFA起始状态出发时才能通过，
+			也就是输入的开头或者上一个字符是换行符
+		*/
+		start.edge = BOL
+	}
+	/*
+		$ 要求匹配后下一个字符是回车换行符或者输入已经结束，它不消耗字符，
+		因此这里是一条epsilon边，由接收节点上的anchor在扫描时向前查看一个字符来判断
+	*/
+
+	return start, end
+}
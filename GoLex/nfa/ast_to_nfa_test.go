@@ -0,0 +1,83 @@
+package nfa
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntersection(t *testing.T) {
+	//由小写字母组成但不是关键字if
+	start := parseSpec(t, "%%\n[a-z]+&~(if) return ID\n")
+	require.True(t, acceptsString(start, "i"))
+	require.True(t, acceptsString(start, "iff"))
+	require.True(t, acceptsString(start, "abc"))
+	require.False(t, acceptsString(start, "if"))
+	require.False(t, acceptsString(start, ""))
+	require.False(t, acceptsString(start, "a1"))
+}
+
+func TestComplementComment(t *testing.T) {
+	//C语言注释中间不能出现 */
+	start := parseSpec(t, "%%\n\"/*\"(~(.*\"*/\".*))\"*/\" return COMMENT\n")
+	require.True(t, acceptsString(start, "/* abc */"))
+	require.True(t, acceptsString(start, "/***/"))
+	require.True(t, acceptsString(start, "/* a * / b */"))
+	require.False(t, acceptsString(start, "/* a */ b */"))
+}
+
+func TestIntersectionPrecedence(t *testing.T) {
+	rules := parseRules(t, "%%\nab&~c|d return 1\n")
+	require.Equal(t, "ab&~c|d", rules[0].Regex.String())
+	_, ok := rules[0].Regex.(*AltNode).Branches[0].(*IntersectNode)
+	require.True(t, ok)
+}
+
+func TestEmptyIntersection(t *testing.T) {
+	start := parseSpec(t, "%%\na+&b+ return 1\n")
+	for _, input := range allStrings("ab", 4) {
+		require.False(t, acceptsString(start, input))
+	}
+}
+
+func TestAnchorsInNfaMatchString(t *testing.T) {
+	start := parseSpec(t, "%%\n^ab   {}\n%%\n")
+	require.True(t, NfaMatchString(start, "ab"))
+	require.False(t, NfaMatchString(start, "\nab"))
+
+	start = parseSpec(t, "%%\nab$   {}\n%%\n")
+	require.True(t, NfaMatchString(start, "ab"))
+	require.False(t, NfaMatchString(start, "ab\n"))
+}
+
+func cycleDFA(n int) *tableDFA {
+	//只接收长度是n的倍数的由a组成的字符串
+	dfa := &tableDFA{trans: make([][]int, n), accept: make([]bool, n)}
+	for s := 0; s < n; s++ {
+		dfa.trans[s] = make([]int, MAX_CHARS)
+		for c := range dfa.trans[s] {
+			dfa.trans[s][c] = F
+		}
+		dfa.trans[s]['a'] = (s + 1) % n
+		dfa.accept[s] = s == 0
+	}
+
+	return dfa
+}
+
+func TestDFAProductLimit(t *testing.T) {
+	dfa, err := intersectDFA(cycleDFA(3), cycleDFA(4))
+	require.Nil(t, err)
+	require.Equal(t, 12, len(dfa.trans))
+
+	//17*16个状态超过DFA_MAX，返回错误而不是panic
+	_, err = intersectDFA(cycleDFA(17), cycleDFA(16))
+	require.Equal(t, ErrTooManyDFAStates, err)
+	_, err = complementDFA(cycleDFA(DFA_MAX))
+	require.Equal(t, ErrTooManyDFAStates, err)
+
+	//倒数第9个字符是a，需要2^9个DFA状态
+	start := parseSpec(t, "%%\n(a|b)*a(a|b)(a|b)(a|b)(a|b)(a|b)(a|b)(a|b)(a|b) return 1\n")
+	_, err = subsetDFA(start)
+	require.Equal(t, ErrTooManyDFAStates, err)
+}
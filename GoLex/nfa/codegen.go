@@ -0,0 +1,356 @@
+package nfa
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+ScannerTables 是最小化后的DFA状态机，所有代码生成器都根据它输出跳转表，
+状态0是起始状态，输入开头或者上一个字符是换行符时从BOLStart开始，F表示没有跳转
+*/
+type ScannerTables struct {
+	NumStates int
+	BOLStart  int      //行首时使用的起始状态
+	Starts    []int    //每个开始条件的起始状态，Starts[0]总是0
+	BOLStarts []int    //每个开始条件在行首时使用的起始状态
+	Trans     [][]int  //完整的跳转表Trans[state][c]，压缩输出时为nil
+	RowMap    []int    //压缩输出时每个状态使用Rows中的哪一行
+	Rows      [][]int  //压缩输出时互不相同的行
+	Accept    []int    //状态对应的动作编号，-1表示不是接收状态
+	AcceptEOL []int    //下一个字符是换行符或者输入结束时状态对应的动作编号，$结尾的规则只出现在这里
+	Actions   []string //所有规则的动作代码
+	//和Accept, AcceptEOL对应，记录的是规则编号而不是动作编号，-1表示不是接收状态
+	AcceptRule    []int
+	AcceptEOLRule []int
+	RuleActions   []int    //每条规则对应的动作编号
+	RuleNames     []string //每条规则的名称，生成的token中会带上它
+	/*
+		REJECT需要知道每个状态能匹配的所有规则，状态i的规则按优先级排列在
+		AcceptList[AcceptBase[i]:AcceptBase[i+1]]中，RuleEOL[rule]为1表示规则以$结尾
+	*/
+	AcceptList []int
+	AcceptBase []int
+	RuleEOL    []int
+	Reject     bool //有规则的动作中使用了REJECT
+}
+
+func (t *ScannerTables) Next(state int, c int) int {
+	if c < 0 || c >= MAX_CHARS {
+		return F
+	}
+
+	if t.Trans != nil {
+		return t.Trans[state][c]
+	}
+
+	return t.Rows[t.RowMap[state]][c]
+}
+
+func (n *NfaDfaConverter) Tables(rules []*Rule) *ScannerTables {
+	/*
+		把当前的DFA跳转表转换成代码生成器使用的形式，如果 %option tables=compressed，
+		那么完全相同的行只保留一份，每个状态通过RowMap找到自己对应的行。
+		动作代码完全相同的规则共用一个动作编号
+	*/
+	tables := &ScannerTables{
+		NumStates: n.nstates,
+		BOLStart:  n.bolStart,
+		Starts:    n.starts,
+		BOLStarts: n.bolStarts,
+		Accept:    make([]int, n.nstates),
+		AcceptEOL: make([]int, n.nstates),
+		Actions:   make([]string, 0),
+
+		AcceptRule:    make([]int, n.nstates),
+		AcceptEOLRule: make([]int, n.nstates),
+		RuleActions:   make([]int, len(rules)),
+		RuleNames:     make([]string, len(rules)),
+
+		AcceptList: make([]int, 0),
+		AcceptBase: make([]int, n.nstates+1),
+		RuleEOL:    make([]int, len(rules)),
+		Reject:     len(RejectRules(rules)) > 0,
+	}
+
+	actionIndex := make(map[string]int)
+	for i, rule := range rules {
+		index, ok := actionIndex[rule.Action]
+		if !ok {
+			index = len(tables.Actions)
+			actionIndex[rule.Action] = index
+			tables.Actions = append(tables.Actions, rule.Action)
+		}
+		tables.RuleActions[i] = index
+		tables.RuleNames[i] = rule.Name
+		if rule.Anchor&END != 0 {
+			tables.RuleEOL[i] = 1
+		}
+	}
+
+	for i := 0; i < n.nstates; i++ {
+		tables.Accept[i] = -1
+		tables.AcceptEOL[i] = -1
+		tables.AcceptRule[i] = -1
+		tables.AcceptEOLRule[i] = -1
+		tables.AcceptList = append(tables.AcceptList, n.dstates[i].accepts...)
+		tables.AcceptBase[i+1] = len(tables.AcceptList)
+		if !n.dstates[i].isAccepted {
+			continue
+		}
+
+		tables.AcceptEOLRule[i] = n.dstates[i].rule
+		tables.AcceptEOL[i] = tables.RuleActions[n.dstates[i].rule]
+		if n.dstates[i].hasPlain {
+			tables.AcceptRule[i] = n.dstates[i].plainRule
+			tables.Accept[i] = tables.RuleActions[n.dstates[i].plainRule]
+		}
+	}
+
+	if n.Options.Tables == TABLES_FULL {
+		tables.Trans = n.dtrans[0:n.nstates]
+		return tables
+	}
+
+	tables.RowMap = make([]int, n.nstates)
+	rowIndex := make(map[string]int)
+	for i := 0; i < n.nstates; i++ {
+		key := fmt.Sprint(n.dtrans[i])
+		index, ok := rowIndex[key]
+		if !ok {
+			index = len(tables.Rows)
+			rowIndex[key] = index
+			tables.Rows = append(tables.Rows, n.dtrans[i])
+		}
+		tables.RowMap[i] = index
+	}
+
+	return tables
+}
+
+var rejectPattern = regexp.MustCompile(`\bREJECT\b`)
+
+func RejectRules(rules []*Rule) []*Rule {
+	/*
+		返回动作中使用了REJECT的规则。只要有一条规则使用REJECT，扫描器就要记录匹配过程中
+		经过的每个状态，以便找到次优的匹配，这会明显降低所有规则的扫描速度
+	*/
+	result := make([]*Rule, 0)
+	for _, rule := range rules {
+		if rejectPattern.MatchString(rule.Action) {
+			result = append(result, rule)
+		}
+	}
+
+	return result
+}
+
+// EOFAction 是一条<<EOF>>规则的动作，以及使用这个动作的开始条件
+type EOFAction struct {
+	Conditions []int
+	Action     string
+}
+
+func EOFActions(reader *LexReader) []*EOFAction {
+	/*
+		为每个开始条件找到输入结束时要执行的<<EOF>>规则，使用同一条规则的开始条件合并在一起，
+		生成的代码根据当前开始条件选择动作，没有<<EOF>>规则的开始条件执行默认的动作
+	*/
+	actions := make([]*EOFAction, 0)
+	ruleAction := make(map[*Rule]*EOFAction)
+	for c := range reader.StartConditions {
+		rule := eofRuleFor(reader.EOFRules, c)
+		if rule == nil {
+			continue
+		}
+		action, ok := ruleAction[rule]
+		if !ok {
+			action = &EOFAction{Action: rule.Action}
+			ruleAction[rule] = action
+			actions = append(actions, action)
+		}
+		action.Conditions = append(action.Conditions, c)
+	}
+
+	return actions
+}
+
+func (t *ScannerTables) NextMatch(states []int, eols []bool, rule int, length int) (int, int) {
+	/*
+		REJECT之后的下一个候选匹配。states[n]是读入n+1个字符后的状态，eols[n]表示其后是否是行尾，
+		先找同样长度下优先级更低的规则，再依次找更短的匹配，都没有时返回UNMATCHED
+	*/
+	for ; length > 0; length-- {
+		state := states[length-1]
+		for _, r := range t.AcceptList[t.AcceptBase[state]:t.AcceptBase[state+1]] {
+			if r > rule && (t.RuleEOL[r] == 0 || eols[length-1]) {
+				return r, length
+			}
+		}
+		rule = UNMATCHED
+	}
+
+	return UNMATCHED, 1
+}
+
+type CodeGenerator interface {
+	//把头部代码，跳转表，动作代码和用户代码输出成一个完整的词法解析程序
+	Generate(w io.Writer, reader *LexReader, tables *ScannerTables) error
+}
+
+func NewCodeGenerator(options *LexOptions) CodeGenerator {
+	switch options.Backend {
+	case BACKEND_GO:
+		return &GoCodeGenerator{options: options}
+	case BACKEND_C:
+		return &CCodeGenerator{options: options}
+	}
+
+	return &PythonCodeGenerator{options: options}
+}
+
+func userCodePlaceholder(i int) string {
+	/*
+		驱动代码中嵌入的用户代码(例如<<EOF>>规则的动作)先用占位符代替，
+		等驱动代码替换完前缀之后再通过fillUserCode填入，用户代码中的yy不能被替换
+	*/
+	return fmt.Sprintf("\x00%d\x00", i)
+}
+
+func fillUserCode(code string, userCode []string) string {
+	for i, body := range userCode {
+		code = strings.Replace(code, userCodePlaceholder(i), body, 1)
+	}
+
+	return code
+}
+
+// 和flex -P一样，%option prefix= 只改变扫描器对外的名称，其余以yy开头的标识符保持不变
+var prefixedSymbols = map[string]bool{
+	"yylex": true, "yytext": true, "yyleng": true, "yyin": true, "yyout": true, "yywrap": true,
+	"yylineno": true, "yytoken": true, "yymore": true, "yyless": true, "yyunput": true,
+	"yypush_buffer_state": true, "yypop_buffer_state": true,
+	"yyscanner": true, "yyextra": true, "yylex_init": true, "yylex_init_extra": true,
+	"yyget_extra": true, "yyset_extra": true, "yyget_in": true, "yyset_in": true, "yyget_out": true, "yyset_out": true,
+	"yyget_text": true, "yyget_leng": true, "yyget_lineno": true, "yyset_lineno": true,
+	"yySymType": true,
+}
+
+func renamePrefix(options *LexOptions, code string) string {
+	/*
+		生成代码中扫描器的名称都以yy开头，%option prefix= 可以把它们换成别的前缀。
+		只替换prefixedSymbols中的名称和扫描器内部使用的yy_开头的名称，后者改名之后同一个包中可以有多个go扫描器。
+		字符串，字符常量和注释中的内容保持不变
+	*/
+	if options.Prefix == "yy" {
+		return code
+	}
+
+	//python的注释以#开头，//是整除运算符
+	python := options.Backend == BACKEND_PYTHON
+	var b strings.Builder
+	for i := 0; i < len(code); {
+		c := code[i]
+		end := i + 1
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			end = goLiteralEnd(code, i)
+		case (!python && strings.HasPrefix(code[i:], "//")) || (python && c == '#'):
+			end = strings.IndexByte(code[i:], '\n')
+			if end == -1 {
+				end = len(code)
+			} else {
+				end += i
+			}
+		case !python && strings.HasPrefix(code[i:], "/*"):
+			end = strings.Index(code[i+2:], "*/")
+			if end == -1 {
+				end = len(code)
+			} else {
+				end += i + 4
+			}
+		case isGoIdentChar(c):
+			for end < len(code) && isGoIdentChar(code[end]) {
+				end++
+			}
+			ident := code[i:end]
+			if prefixedSymbols[ident] || strings.HasPrefix(ident, "yy_") {
+				b.WriteString(options.Prefix + ident[len("yy"):])
+				i = end
+				continue
+			}
+		}
+		b.WriteString(code[i:end])
+		i = end
+	}
+
+	return b.String()
+}
+
+func intList(values []int) string {
+	items := make([]string, 0, len(values))
+	for _, v := range values {
+		items = append(items, fmt.Sprint(v))
+	}
+
+	return strings.Join(items, ", ")
+}
+
+func quotedList(values []string) string {
+	//go, c和python都能识别strconv.Quote输出的ascii字符串
+	items := make([]string, 0, len(values))
+	for _, v := range values {
+		items = append(items, strconv.QuoteToASCII(v))
+	}
+
+	return strings.Join(items, ", ")
+}
+
+func dedent(code string) string {
+	//去掉所有行共同的缩进
+	lines := strings.Split(code, "\n")
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		width := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent == -1 || width < indent {
+			indent = width
+		}
+	}
+
+	for i, line := range lines {
+		if len(line) >= indent && indent > 0 {
+			lines[i] = line[indent:]
+		} else {
+			lines[i] = strings.TrimLeft(line, " \t")
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func actionBody(action string) string {
+	//动作代码如果被大括号包裹，那么去掉最外层的大括号
+	action = strings.TrimSpace(action)
+	if strings.HasPrefix(action, "{") && strings.HasSuffix(action, "}") {
+		action = action[1 : len(action)-1]
+	}
+
+	return strings.Trim(dedent(action), "\n")
+}
+
+func indentCode(code string, indent string) string {
+	lines := strings.Split(code, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			lines[i] = indent + line
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,561 @@
+package nfa
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type CCodeGenerator struct {
+	options *LexOptions
+}
+
+const cScannerDriver = `
+static int yy_next(int state, unsigned char c)
+{
+    if (c >= YY_MAX_CHARS) {
+        return YY_F;
+    }
+    return %s;
+}
+
+static yy_position yy_advance(yy_position p, const char *text, int len)
+{
+    int i;
+    for (i = 0; i < len; i++) {
+        if (text[i] == '\n') {
+            p.line += 1;
+            p.column = 1;
+        } else if (text[i] == '\t') {
+            p.column = ((p.column - 1) / YY_TAB_WIDTH + 1) * YY_TAB_WIDTH + 1;
+        } else {
+            p.column += 1;
+        }
+    }
+    p.offset += (long)len;
+    return p;
+}
+
+static int yy_at_bol(void)
+{
+    if (yy_pos == 0) {
+        return yy_bol;
+    }
+    return yy_buffer[yy_pos - 1] == '\n';
+}
+
+static int yy_fill(void)
+{
+    /* 读入更多的输入，已经处理过的字符从缓冲区中删除，输入结束时返回0 */
+    size_t keep = yy_pos - yy_more_len;
+    size_t n;
+    if (yy_eof) {
+        return 0;
+    }
+    if (keep > 0) {
+        yy_bol = yy_at_bol();
+        memmove(yy_buffer, yy_buffer + keep, yy_len - keep);
+        yy_len -= keep;
+        yy_pos -= keep;
+    }
+    if (yy_capacity - yy_len < YY_READ_SIZE) {
+        yy_capacity = 2 * yy_capacity + YY_READ_SIZE;
+        yy_buffer = (char *)realloc(yy_buffer, yy_capacity);
+    }
+    n = fread(yy_buffer + yy_len, 1, YY_READ_SIZE, yyin);
+    if (n == 0) {
+        yy_eof = 1;
+        return 0;
+    }
+    yy_len += n;
+    return 1;
+}
+
+static void yy_fatal_error(const char *msg)
+{
+    fprintf(stderr, "%%s\n", msg);
+    exit(2);
+}
+
+/* 只保留yytext的前n个字符，其余的字符退回输入重新匹配 */
+void yyless(int n)
+{
+%s    yy_pos -= (size_t)(yyleng - n);
+    yyleng = n;
+    yytext[n] = '\0';
+    yytoken.length = n;
+    yy_cur = yy_advance(yytoken.start, yytext, n);
+    yytoken.end = yy_cur;
+}
+
+/* 把字符c退回输入，下一次匹配从c开始 */
+void yyunput(int c)
+{
+    if (yy_len == yy_capacity) {
+        yy_capacity = 2 * yy_capacity + YY_READ_SIZE;
+        yy_buffer = (char *)realloc(yy_buffer, yy_capacity);
+    }
+    memmove(yy_buffer + yy_pos + 1, yy_buffer + yy_pos, yy_len - yy_pos);
+    yy_buffer[yy_pos] = (char)c;
+    yy_len += 1;
+}
+
+/* 让下一次匹配的字符串接在yytext后面，而不是替换yytext */
+void yymore(void)
+{
+    yy_more_len = (size_t)yyleng;
+    yy_more_start = yytoken.start;
+}
+
+/* 把当前开始条件压栈，然后切换到开始条件c */
+void yy_push_state(int c)
+{
+    if (yy_start_stack_top == yy_start_stack_size) {
+        yy_start_stack_size = 2 * yy_start_stack_size + 8;
+        yy_start_stack = (int *)realloc(yy_start_stack, yy_start_stack_size * sizeof(int));
+    }
+    yy_start_stack[yy_start_stack_top++] = yy_start;
+    yy_start = c;
+}
+
+/* 切换到栈顶的开始条件并把它出栈 */
+void yy_pop_state(void)
+{
+    if (yy_start_stack_top == 0) {
+        yy_fatal_error("start-condition stack underflow");
+    }
+    yy_start = yy_start_stack[--yy_start_stack_top];
+}
+
+/* 返回栈顶的开始条件，不改变当前开始条件 */
+int yy_top_state(void)
+{
+    if (yy_start_stack_top == 0) {
+        yy_fatal_error("start-condition stack underflow");
+    }
+    return yy_start_stack[yy_start_stack_top - 1];
+}
+
+/* 为输入file创建一个新的读取状态，size是缓冲区的初始大小 */
+YY_BUFFER_STATE yy_create_buffer(FILE *file, int size)
+{
+    YY_BUFFER_STATE b = (YY_BUFFER_STATE)malloc(sizeof(struct yy_buffer_state));
+    b->input = file;
+    b->capacity = (size_t)size;
+    b->buffer = (char *)malloc(b->capacity);
+    b->len = 0;
+    b->pos = 0;
+    b->eof = 0;
+    b->bol = 1;
+    b->cur.offset = 0;
+    b->cur.line = 1;
+    b->cur.column = 1;
+    return b;
+}
+
+static void yy_save_buffer_state(void)
+{
+    YY_BUFFER_STATE b = yy_current_buffer;
+    if (b == NULL) {
+        return;
+    }
+    b->input = yyin;
+    b->buffer = yy_buffer;
+    b->len = yy_len;
+    b->pos = yy_pos;
+    b->capacity = yy_capacity;
+    b->eof = yy_eof;
+    b->bol = yy_bol;
+    b->cur = yy_cur;
+}
+
+static void yy_load_buffer_state(void)
+{
+    YY_BUFFER_STATE b = yy_current_buffer;
+    yyin = b->input;
+    yy_buffer = b->buffer;
+    yy_len = b->len;
+    yy_pos = b->pos;
+    yy_capacity = b->capacity;
+    yy_eof = b->eof;
+    yy_bol = b->bol;
+    yy_cur = b->cur;
+    yy_more_len = 0;
+}
+
+/* 之后从b读取输入，原来的输入停在当前位置，可以再切换回去 */
+void yy_switch_to_buffer(YY_BUFFER_STATE b)
+{
+    yy_save_buffer_state();
+    yy_current_buffer = b;
+    yy_load_buffer_state();
+}
+
+/* 暂停当前的输入转而读取b，yypop_buffer_state之后恢复原来的输入 */
+void yypush_buffer_state(YY_BUFFER_STATE b)
+{
+    yy_save_buffer_state();
+    if (yy_current_buffer != NULL) {
+        if (yy_buffer_stack_top == yy_buffer_stack_size) {
+            yy_buffer_stack_size = 2 * yy_buffer_stack_size + 8;
+            yy_buffer_stack = (YY_BUFFER_STATE *)realloc(yy_buffer_stack, yy_buffer_stack_size * sizeof(YY_BUFFER_STATE));
+        }
+        yy_buffer_stack[yy_buffer_stack_top++] = yy_current_buffer;
+    }
+    yy_current_buffer = b;
+    yy_load_buffer_state();
+}
+
+void yy_delete_buffer(YY_BUFFER_STATE b)
+{
+    if (b == NULL) {
+        return;
+    }
+    if (b == yy_current_buffer) {
+        /* 正在读取的缓冲区可能已经被yy_fill重新分配，先同步回b */
+        yy_save_buffer_state();
+        yy_current_buffer = NULL;
+        yy_buffer = NULL;
+    }
+    free(b->buffer);
+    free(b);
+}
+
+/* 丢弃当前的输入，恢复被yypush_buffer_state暂停的输入，没有时YY_CURRENT_BUFFER为NULL */
+void yypop_buffer_state(void)
+{
+    yy_delete_buffer(yy_current_buffer);
+    if (yy_buffer_stack_top > 0) {
+        yy_current_buffer = yy_buffer_stack[--yy_buffer_stack_top];
+        yy_load_buffer_state();
+    }
+}
+
+%sint yylex(void)
+{
+    int state, i, yy_act, yy_end, yy_eol;
+    int yy_last_accept;
+    size_t n, yy_last_len;
+%s
+    if (yyin == NULL) {
+        yyin = stdin;
+    }
+    if (yyout == NULL) {
+        yyout = stdout;
+    }
+
+    for (;;) {
+        if (yy_current_buffer == NULL) {
+            yy_switch_to_buffer(yy_create_buffer(yyin, YY_BUF_SIZE));
+        }
+
+        if (yy_pos == yy_len && !yy_fill()) {
+%s
+        }
+
+        /* 从当前开始条件的起始状态开始尽可能多地读取字符，记录最后一次进入接收状态的位置，行首时从另一个起始状态开始 */
+        state = yy_start_state[yy_start];
+        if (yy_at_bol()) {
+            state = yy_bol_start_state[yy_start];
+        }
+        yy_last_accept = -1;
+        yy_last_len = 1;
+%s        for (n = 0;; n++) {
+            state = yy_next(state, (unsigned char)yy_buffer[yy_pos + n]);
+            if (state == YY_F) {
+                break;
+            }
+            if (n >= YY_MAX_TOKEN) {
+                if (yy_last_accept != -1) {
+                    /* 超出长度之前已经有规则接收，使用最长的那个匹配 */
+                    break;
+                }
+                yy_fatal_error("token too long, exceeds maxtoken=%d");
+            }
+            if (yy_pos + n + 1 == yy_len) {
+                yy_fill();
+            }
+            yy_end = yy_pos + n + 1 == yy_len;
+            yy_eol = yy_end || yy_buffer[yy_pos + n + 1] == '\n' || yy_buffer[yy_pos + n + 1] == '\r';
+%s            yy_act = yy_accept[state];
+            if (yy_eol) {
+                /* 下一个字符是换行符或者输入已经结束，$结尾的规则可以接收 */
+                yy_act = yy_accept_eol[state];
+            }
+            if (yy_act != -1) {
+                yy_last_accept = yy_act;
+                yy_last_len = n + 1;
+            }
+            if (yy_end) {
+                break;
+            }
+        }
+
+%s        if (yy_last_accept == -1) {
+            /* 没有规则能够匹配，把当前字符原样输出 */
+            fputc(yy_buffer[yy_pos], yyout);
+            yy_cur = yy_advance(yy_cur, yy_buffer + yy_pos, 1);
+            yy_pos += 1;
+            continue;
+        }
+
+        yyleng = (int)(yy_more_len + yy_last_len);
+        yytext = (char *)realloc(yytext, (size_t)yyleng + 1);
+        memcpy(yytext, yy_buffer + yy_pos - yy_more_len, (size_t)yyleng);
+        yytext[yyleng] = '\0';
+        yytoken.rule = yy_last_accept;
+        yytoken.name = yy_rule_names[yy_last_accept];
+        yytoken.lexeme = yytext;
+        yytoken.length = yyleng;
+        yytoken.start = yy_more_len > 0 ? yy_more_start : yy_cur;
+        yy_cur = yy_advance(yy_cur, yy_buffer + yy_pos, (int)yy_last_len);
+        yytoken.end = yy_cur;
+        yy_pos += yy_last_len;
+%s        yy_more_len = 0;
+        switch (yy_rule_action[yy_last_accept]) {
+`
+
+const cRejectFunc = `static int yy_states[YY_MAX_TOKEN];
+static char yy_eols[YY_MAX_TOKEN];
+static size_t yy_nstates = 0;
+
+/* 返回REJECT之后的下一个候选: 同样长度下排在后面的规则，或者更短的匹配 */
+static int yy_next_match(int rule, size_t *length)
+{
+    int i, r, state;
+    for (; *length > 0; *length -= 1) {
+        state = yy_states[*length - 1];
+        for (i = yy_accept_base[state]; i < yy_accept_base[state + 1]; i++) {
+            r = yy_accept_list[i];
+            if (r > rule && (yy_rule_eol[r] == 0 || yy_eols[*length - 1])) {
+                return r;
+            }
+        }
+        rule = -1;
+    }
+    *length = 1;
+    return -1;
+}
+
+`
+
+const cRejectFind = `    yy_find_rule:
+        if (yy_rejected) {
+            yy_rejected = 0;
+            yy_pos = yy_match_pos;
+            yy_cur = yy_match_cur;
+            yy_more_len = yy_match_more;
+            yylineno = yy_match_lineno;
+            yy_last_accept = yy_next_match(yy_last_accept, &yy_last_len);
+        }
+        yy_match_pos = yy_pos;
+        yy_match_cur = yy_cur;
+        yy_match_more = yy_more_len;
+        yy_match_lineno = yylineno;
+
+`
+
+func (g *CCodeGenerator) writeTokenKinds(w *strings.Builder, tokens []*TokenDecl) {
+	//c没有方法，TokenKind_String在名称表中查找token的名称，找不到时返回NULL
+	w.WriteString("typedef enum {\n")
+	for i, token := range tokens {
+		separator := ","
+		if i == len(tokens)-1 {
+			separator = ""
+		}
+		fmt.Fprintf(w, "    %s = %d%s\n", token.Name, token.Value, separator)
+	}
+	w.WriteString("} TokenKind;\n\n")
+
+	unique := uniqueTokenKinds(tokens)
+	fmt.Fprintf(w, renamePrefix(g.options, "static const struct {\n    TokenKind kind;\n    const char *name;\n} yy_token_names[%d] = {\n"), len(unique))
+	for _, token := range unique {
+		fmt.Fprintf(w, "    {%s, %q},\n", token.Name, token.Name)
+	}
+	w.WriteString("};\n\n")
+	fmt.Fprintf(w, renamePrefix(g.options, `const char *TokenKind_String(TokenKind kind) {
+    int i;
+    for (i = 0; i < %d; i++) {
+        if (yy_token_names[i].kind == kind) {
+            return yy_token_names[i].name;
+        }
+    }
+    return NULL;
+}
+
+`), len(unique))
+}
+
+func (g *CCodeGenerator) Generate(w io.Writer, reader *LexReader, tables *ScannerTables) error {
+	if g.options.Reentrant {
+		//状态都在yy_scanner中的扫描器目前只有go代码生成器支持
+		return fmt.Errorf("reentrant is only supported by the go backend")
+	}
+	if g.options.GoYacc {
+		return fmt.Errorf("goyacc is only supported by the go backend")
+	}
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "/* Code generated by GoLex from %s. DO NOT EDIT. */\n\n", reader.InputFileName)
+	b.WriteString("#include <stdio.h>\n#include <stdlib.h>\n#include <string.h>\n\n")
+	if reader.HeaderCode != "" {
+		b.WriteString(reader.HeaderCode + "\n")
+	}
+
+	var driver strings.Builder
+	driver.WriteString("/* 输入中的一个位置，offset从0开始，line和column从1开始 */\n")
+	driver.WriteString("typedef struct {\n    long offset;\n    int line;\n    int column;\n} yy_position;\n\n")
+	driver.WriteString("/* 最近一次匹配的结果，lexeme和yytext相同 */\n")
+	driver.WriteString("typedef struct {\n    int rule;\n    const char *name;\n    const char *lexeme;\n    int length;\n    yy_position start;\n    yy_position end;\n} yy_token;\n\n")
+	driver.WriteString("yy_token yytoken;\n")
+	driver.WriteString("FILE *yyin = NULL;\n")
+	driver.WriteString("FILE *yyout = NULL;\n")
+	driver.WriteString("char *yytext = NULL;\n")
+	driver.WriteString("int yyleng = 0;\n")
+	driver.WriteString("int yylineno = 1;\n")
+	driver.WriteString("static char *yy_buffer = NULL;\n")
+	driver.WriteString("static size_t yy_len = 0;\n")
+	driver.WriteString("static size_t yy_pos = 0;\n")
+	driver.WriteString("static size_t yy_capacity = 0;\n")
+	driver.WriteString("static int yy_eof = 0;\n")
+	driver.WriteString("static int yy_bol = 1;\n")
+	driver.WriteString("static size_t yy_more_len = 0;\n")
+	driver.WriteString("static yy_position yy_more_start;\n")
+	driver.WriteString("static yy_position yy_cur = {0, 1, 1};\n")
+	driver.WriteString("static int yy_start = 0;\n")
+	driver.WriteString("static int *yy_start_stack = NULL;\n")
+	driver.WriteString("static size_t yy_start_stack_top = 0;\n")
+	driver.WriteString("static size_t yy_start_stack_size = 0;\n\n")
+	driver.WriteString("/* 一个输入的读取状态，正在读取的输入的状态保存在yy_buffer等变量中 */\n")
+	driver.WriteString("struct yy_buffer_state {\n    FILE *input;\n    char *buffer;\n    size_t len;\n    size_t pos;\n    size_t capacity;\n    int eof;\n    int bol;\n    yy_position cur;\n};\n\n")
+	driver.WriteString("typedef struct yy_buffer_state *YY_BUFFER_STATE;\n\n")
+	driver.WriteString("static YY_BUFFER_STATE yy_current_buffer = NULL;\n")
+	driver.WriteString("static YY_BUFFER_STATE *yy_buffer_stack = NULL;\n")
+	driver.WriteString("static size_t yy_buffer_stack_top = 0;\n")
+	driver.WriteString("static size_t yy_buffer_stack_size = 0;\n\n")
+	driver.WriteString("#define YY_F (-1)\n")
+	fmt.Fprintf(&driver, "#define YY_MAX_CHARS %d\n", MAX_CHARS)
+	fmt.Fprintf(&driver, "#define YY_TAB_WIDTH %d\n", g.options.TabWidth)
+	fmt.Fprintf(&driver, "#define YY_READ_SIZE %d\n", READ_SIZE)
+	fmt.Fprintf(&driver, "#define YY_BUF_SIZE %d\n", READ_SIZE)
+	fmt.Fprintf(&driver, "#define YY_MAX_TOKEN %d\n", g.options.MaxToken)
+	driver.WriteString("#define ECHO fwrite(yytext, (size_t)yyleng, 1, yyout)\n")
+	driver.WriteString("#define unput(c) yyunput(c)\n")
+	driver.WriteString("#define BEGIN yy_start =\n")
+	driver.WriteString("#define YY_START yy_start\n")
+	driver.WriteString("#define YY_CURRENT_BUFFER yy_current_buffer\n")
+	if tables.Reject {
+		driver.WriteString("#define REJECT { yy_rejected = 1; goto yy_find_rule; }\n")
+	}
+	driver.WriteString("\n")
+	if !g.options.NoYYWrap {
+		driver.WriteString("int yywrap(void);\n\n")
+	}
+	//每个开始条件的起始状态，以及在行首时使用的起始状态
+	fmt.Fprintf(&driver, "static const int yy_start_state[%d] = {%s};\n\n", len(tables.Starts), intList(tables.Starts))
+	fmt.Fprintf(&driver, "static const int yy_bol_start_state[%d] = {%s};\n\n", len(tables.BOLStarts), intList(tables.BOLStarts))
+	//接收状态对应的规则编号，再通过yy_rule_action找到要执行的动作
+	fmt.Fprintf(&driver, "static const int yy_accept[%d] = {%s};\n\n", tables.NumStates, intList(tables.AcceptRule))
+	fmt.Fprintf(&driver, "static const int yy_accept_eol[%d] = {%s};\n\n", tables.NumStates, intList(tables.AcceptEOLRule))
+	fmt.Fprintf(&driver, "static const int yy_rule_action[%d] = {%s};\n\n", len(tables.RuleActions), intList(tables.RuleActions))
+	if tables.Reject {
+		fmt.Fprintf(&driver, "static const int yy_accept_list[%d] = {%s};\n\n", len(tables.AcceptList), intList(tables.AcceptList))
+		fmt.Fprintf(&driver, "static const int yy_accept_base[%d] = {%s};\n\n", len(tables.AcceptBase), intList(tables.AcceptBase))
+		fmt.Fprintf(&driver, "static const int yy_rule_eol[%d] = {%s};\n\n", len(tables.RuleEOL), intList(tables.RuleEOL))
+	}
+	b.WriteString(renamePrefix(g.options, driver.String()))
+	driver.Reset()
+
+	//规则名称是用户的正则表达式，不能替换其中的yy前缀
+	names := fmt.Sprintf("static const char *yy_rule_names[%d] = {", len(tables.RuleNames))
+	b.WriteString(renamePrefix(g.options, names) + quotedList(tables.RuleNames) + "};\n\n")
+
+	//开始条件的名称由用户声明，同样不能替换前缀
+	for i, condition := range reader.StartConditions {
+		fmt.Fprintf(&b, "#define %s %d\n", condition.Name, i)
+	}
+	b.WriteString("\n")
+	if len(reader.Tokens) > 0 {
+		g.writeTokenKinds(&b, reader.Tokens)
+	}
+
+	next := "yy_trans[state][c]"
+	if tables.Trans != nil {
+		fmt.Fprintf(&driver, "static const int yy_trans[%d][YY_MAX_CHARS] = {\n", tables.NumStates)
+		for _, row := range tables.Trans {
+			fmt.Fprintf(&driver, "    {%s},\n", intList(row))
+		}
+		driver.WriteString("};\n")
+	} else {
+		next = "yy_rows[yy_rowmap[state]][c]"
+		fmt.Fprintf(&driver, "static const int yy_rowmap[%d] = {%s};\n\n", tables.NumStates, intList(tables.RowMap))
+		fmt.Fprintf(&driver, "static const int yy_rows[%d][YY_MAX_CHARS] = {\n", len(tables.Rows))
+		for _, row := range tables.Rows {
+			fmt.Fprintf(&driver, "    {%s},\n", intList(row))
+		}
+		driver.WriteString("};\n")
+	}
+
+	/*
+		输入结束时先调用yywrap，yywrap由用户提供，返回0表示已经通过yyin设置了新的输入。
+		然后执行当前开始条件的<<EOF>>规则，动作中可以切换输入，没有<<EOF>>规则时yylex返回0
+	*/
+	var eof strings.Builder
+	userCode := make([]string, 0)
+	if !g.options.NoYYWrap {
+		eof.WriteString("            if (!yywrap()) {\n                yy_delete_buffer(yy_current_buffer);\n                continue;\n            }\n")
+	}
+	if eofActions := EOFActions(reader); len(eofActions) > 0 {
+		eof.WriteString("            switch (yy_start) {\n")
+		for _, action := range eofActions {
+			for _, c := range action.Conditions {
+				fmt.Fprintf(&eof, "            case %d:\n", c)
+			}
+			if body := tokenActionBody(action.Action, "return %s;"); body != "" {
+				userCode = append(userCode, indentCode(body, "                    "))
+				eof.WriteString("                {\n" + userCodePlaceholder(len(userCode)-1) + "\n                }\n")
+			}
+			eof.WriteString("                continue;\n")
+		}
+		eof.WriteString("            }\n")
+	}
+	eof.WriteString("            return 0;")
+
+	lineNo := ""
+	lessLineNo := ""
+	if g.options.YYLineNo {
+		//yymore保留的部分已经统计过，yyless退回的部分要重新统计
+		lineNo = "        for (i = (int)yy_more_len; i < yyleng; i++) {\n            if (yytext[i] == '\\n') {\n                yylineno += 1;\n            }\n        }\n"
+		lessLineNo = "    int i;\n    for (i = n; i < yyleng; i++) {\n        if (yytext[i] == '\\n') {\n            yylineno -= 1;\n        }\n    }\n"
+	}
+
+	//使用REJECT时记录匹配过程中的所有状态，动作中的REJECT跳回yy_find_rule选择下一个候选
+	rejectFunc, rejectVars, rejectReset, rejectRecord, rejectFind := "", "", "", "", ""
+	if tables.Reject {
+		rejectFunc = cRejectFunc
+		rejectVars = "    int yy_rejected = 0, yy_match_lineno = 0;\n    size_t yy_match_pos = 0, yy_match_more = 0;\n    yy_position yy_match_cur = yy_cur;\n"
+		rejectReset = "        yy_nstates = 0;\n"
+		rejectRecord = "            yy_states[yy_nstates] = state;\n            yy_eols[yy_nstates] = (char)yy_eol;\n            yy_nstates += 1;\n"
+		rejectFind = cRejectFind
+	}
+
+	fmt.Fprintf(&driver, cScannerDriver, next, lessLineNo, rejectFunc, rejectVars, eof.String(), rejectReset, g.options.MaxToken, rejectRecord, rejectFind, lineNo)
+	b.WriteString(fillUserCode(renamePrefix(g.options, driver.String()), userCode))
+
+	for i, action := range tables.Actions {
+		fmt.Fprintf(&b, "        case %d:\n", i)
+		if body := tokenActionBody(action, "return %s;"); body != "" {
+			b.WriteString("            {\n" + indentCode(body, "                ") + "\n            }\n")
+		}
+		b.WriteString("            break;\n")
+	}
+	b.WriteString("        }\n    }\n}\n")
+
+	if reader.UserCode != "" {
+		b.WriteString("\n" + reader.UserCode)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,567 @@
+package nfa
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type GoCodeGenerator struct {
+	options *LexOptions
+}
+
+const goScannerDriver = `
+func yy_next(state int, c byte) int {
+	if int(c) >= yy_max_chars {
+		return yy_F
+	}
+	return %s
+}
+
+//ECHO 把匹配的字符串原样输出
+func ECHO() {
+	yyout.Write([]byte(yytext))
+}
+
+//yy_position 是输入中的一个位置，Offset从0开始，Line和Column从1开始
+type yy_position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func (p yy_position) advance(text []byte) yy_position {
+	for _, c := range text {
+		switch c {
+		case '\n':
+			p.Line += 1
+			p.Column = 1
+		case '\t':
+			p.Column = ((p.Column-1)/yy_tab_width+1)*yy_tab_width + 1
+		default:
+			p.Column += 1
+		}
+	}
+	p.Offset += len(text)
+	return p
+}
+
+//yy_token 是最近一次匹配的结果，执行动作代码时可以通过yytoken读取
+type yy_token struct {
+	Rule   int
+	Name   string
+	Lexeme []byte
+	Start  yy_position
+	End    yy_position
+}
+
+//yy_fill 读入更多的输入，已经处理过的字符从缓冲区中删除，输入结束时返回false
+func yy_fill() bool {
+	if yy_eof {
+		return false
+	}
+	if keep := yy_pos - yy_more_len; keep > 0 {
+		yy_bol = yy_at_bol()
+		yy_buffer = append(yy_buffer[:0], yy_buffer[keep:]...)
+		yy_pos -= keep
+	}
+	for {
+		n := len(yy_buffer)
+		if cap(yy_buffer)-n < yy_read_size {
+			buffer := make([]byte, n, 2*cap(yy_buffer)+yy_read_size)
+			copy(buffer, yy_buffer)
+			yy_buffer = buffer
+		}
+		read, err := yyin.Read(yy_buffer[n:cap(yy_buffer)])
+		yy_buffer = yy_buffer[:n+read]
+		if err != nil {
+			yy_eof = true
+			return read > 0
+		}
+		if read > 0 {
+			return true
+		}
+	}
+}
+
+func yy_at_bol() bool {
+	if yy_pos == 0 {
+		return yy_bol
+	}
+	return yy_buffer[yy_pos-1] == '\n'
+}
+
+func yy_fatal_error(msg string) {
+	os.Stderr.WriteString(msg + "\n")
+	os.Exit(2)
+}
+
+//yyless 只保留yytext的前n个字符，其余的字符退回输入重新匹配
+func yyless(n int) {
+%s	yy_pos -= yyleng - n
+	yytext = yytext[:n]
+	yyleng = n
+	yytoken.Lexeme = yytoken.Lexeme[:n]
+	yy_cur = yytoken.Start.advance(yytoken.Lexeme)
+	yytoken.End = yy_cur
+}
+
+//unput 把字符c退回输入，下一次匹配从c开始
+func unput(c byte) {
+	yy_buffer = append(yy_buffer, 0)
+	copy(yy_buffer[yy_pos+1:], yy_buffer[yy_pos:])
+	yy_buffer[yy_pos] = c
+}
+
+//yymore 让下一次匹配的字符串接在yytext后面，而不是替换yytext
+func yymore() {
+	yy_more_len = yyleng
+	yy_more_start = yytoken.Start
+}
+
+//BEGIN 切换开始条件，之后只匹配在该开始条件下有效的规则
+func BEGIN(c int) {
+	yy_start = c
+}
+
+//YY_START 返回当前的开始条件
+func YY_START() int {
+	return yy_start
+}
+
+//yy_push_state 把当前开始条件压栈，然后切换到开始条件c
+func yy_push_state(c int) {
+	yy_start_stack = append(yy_start_stack, yy_start)
+	yy_start = c
+}
+
+//yy_pop_state 切换到栈顶的开始条件并把它出栈
+func yy_pop_state() {
+	if len(yy_start_stack) == 0 {
+		yy_fatal_error("start-condition stack underflow")
+	}
+	yy_start = yy_start_stack[len(yy_start_stack)-1]
+	yy_start_stack = yy_start_stack[:len(yy_start_stack)-1]
+}
+
+//yy_top_state 返回栈顶的开始条件，不改变当前开始条件
+func yy_top_state() int {
+	if len(yy_start_stack) == 0 {
+		yy_fatal_error("start-condition stack underflow")
+	}
+	return yy_start_stack[len(yy_start_stack)-1]
+}
+
+//yy_buffer_state 是一个输入的读取状态，正在读取的输入的状态保存在yy_buffer等变量中
+type yy_buffer_state struct {
+	input  io.Reader
+	buffer []byte
+	pos    int
+	eof    bool
+	bol    bool
+	cur    yy_position
+}
+
+//yy_create_buffer 为输入r创建一个新的读取状态，size是缓冲区的初始大小
+func yy_create_buffer(r io.Reader, size int) *yy_buffer_state {
+	return &yy_buffer_state{
+		input:  r,
+		buffer: make([]byte, 0, size),
+		bol:    true,
+		cur:    yy_position{Offset: 0, Line: 1, Column: 1},
+	}
+}
+
+func yy_save_buffer_state() {
+	if yy_current_buffer == nil {
+		return
+	}
+	b := yy_current_buffer
+	b.input, b.buffer, b.pos, b.eof, b.bol, b.cur = yyin, yy_buffer, yy_pos, yy_eof, yy_bol, yy_cur
+}
+
+func yy_load_buffer_state() {
+	b := yy_current_buffer
+	yyin, yy_buffer, yy_pos, yy_eof, yy_bol, yy_cur = b.input, b.buffer, b.pos, b.eof, b.bol, b.cur
+	yy_more_len = 0
+}
+
+//yy_switch_to_buffer 之后从b读取输入，原来的输入停在当前位置，可以再切换回去
+func yy_switch_to_buffer(b *yy_buffer_state) {
+	yy_save_buffer_state()
+	yy_current_buffer = b
+	yy_load_buffer_state()
+}
+
+//yypush_buffer_state 暂停当前的输入转而读取b，yypop_buffer_state之后恢复原来的输入
+func yypush_buffer_state(b *yy_buffer_state) {
+	yy_save_buffer_state()
+	if yy_current_buffer != nil {
+		yy_buffer_stack = append(yy_buffer_stack, yy_current_buffer)
+	}
+	yy_current_buffer = b
+	yy_load_buffer_state()
+}
+
+//yypop_buffer_state 丢弃当前的输入，恢复被yypush_buffer_state暂停的输入，没有时YY_CURRENT_BUFFER返回nil
+func yypop_buffer_state() {
+	yy_current_buffer = nil
+	if n := len(yy_buffer_stack); n > 0 {
+		yy_current_buffer = yy_buffer_stack[n-1]
+		yy_buffer_stack = yy_buffer_stack[:n-1]
+		yy_load_buffer_state()
+	}
+}
+
+func yy_delete_buffer(b *yy_buffer_state) {
+	if b == yy_current_buffer {
+		yy_current_buffer = nil
+	}
+	b.buffer = nil
+}
+
+func YY_CURRENT_BUFFER() *yy_buffer_state {
+	return yy_current_buffer
+}
+
+%sfunc yylex(%s) int {
+%s	for {
+		if yy_current_buffer == nil {
+			yy_switch_to_buffer(yy_create_buffer(yyin, yy_buf_size))
+		}
+
+		if yy_pos == len(yy_buffer) && !yy_fill() {
+%s
+		}
+
+		//从当前开始条件的起始状态开始尽可能多地读取字符，记录最后一次进入接收状态的位置，行首时从另一个起始状态开始
+		state := yy_start_state[yy_start]
+		if yy_at_bol() {
+			state = yy_bol_start_state[yy_start]
+		}
+		yy_last_accept := -1
+		yy_last_len := 1
+%s		for n := 0; ; n++ {
+			state = yy_next(state, yy_buffer[yy_pos+n])
+			if state == yy_F {
+				break
+			}
+			if n >= yy_max_token {
+				if yy_last_accept != -1 {
+					//超出长度之前已经有规则接收，使用最长的那个匹配
+					break
+				}
+				yy_fatal_error("token too long, exceeds maxtoken=%d")
+			}
+			if yy_pos+n+1 == len(yy_buffer) {
+				yy_fill()
+			}
+			yy_end := yy_pos+n+1 == len(yy_buffer)
+			yy_eol := yy_end || yy_buffer[yy_pos+n+1] == '\n' || yy_buffer[yy_pos+n+1] == '\r'
+%s			yy_act := yy_accept[state]
+			if yy_eol {
+				//下一个字符是换行符或者输入已经结束，$结尾的规则可以接收
+				yy_act = yy_accept_eol[state]
+			}
+			if yy_act != -1 {
+				yy_last_accept = yy_act
+				yy_last_len = n + 1
+			}
+			if yy_end {
+				break
+			}
+		}
+
+%s		if yy_last_accept == -1 {
+			//没有规则能够匹配，把当前字符原样输出
+			yyout.Write(yy_buffer[yy_pos : yy_pos+1])
+			yy_cur = yy_cur.advance(yy_buffer[yy_pos : yy_pos+1])
+			yy_pos += 1
+			continue
+		}
+
+		yytext = string(yy_buffer[yy_pos-yy_more_len : yy_pos+yy_last_len])
+		yyleng = len(yytext)
+		yytoken = yy_token{
+			Rule:   yy_last_accept,
+			Name:   yy_rule_names[yy_last_accept],
+			Lexeme: []byte(yytext),
+			Start:  yy_cur,
+		}
+		if yy_more_len > 0 {
+			yytoken.Start = yy_more_start
+		}
+		yy_cur = yy_cur.advance(yy_buffer[yy_pos : yy_pos+yy_last_len])
+		yytoken.End = yy_cur
+		yy_pos += yy_last_len
+%s		yy_more_len = 0
+		switch yy_rule_action[yy_last_accept] {
+`
+
+// yy_itoa 用于String()等方法，生成的代码只导入io和os，不和头部代码中的import冲突
+const goItoaFunc = `
+func yy_itoa(n int) string {
+	if n < 0 {
+		return "-" + yy_itoa(-n)
+	}
+	digits := []byte{byte('0' + n%10)}
+	for n /= 10; n > 0; n /= 10 {
+		digits = append([]byte{byte('0' + n%10)}, digits...)
+	}
+	return string(digits)
+}
+`
+
+const goRejectFunc = `//yy_next_match 返回REJECT之后的下一个候选: 同样长度下排在后面的规则，或者更短的匹配
+func yy_next_match(rule int, length int) (int, int) {
+	for ; length > 0; length-- {
+		state := yy_states[length-1]
+		for i := yy_accept_base[state]; i < yy_accept_base[state+1]; i++ {
+			r := yy_accept_list[i]
+			if r > rule && (yy_rule_eol[r] == 0 || yy_eols[length-1]) {
+				return r, length
+			}
+		}
+		rule = -1
+	}
+	return -1, 1
+}
+
+`
+
+const goRejectFind = `	yy_find_rule:
+		if yy_rejected {
+			yy_rejected = false
+			yy_pos, yy_cur, yy_more_len, yylineno = yy_match_pos, yy_match_cur, yy_match_more, yy_match_lineno
+			yy_last_accept, yy_last_len = yy_next_match(yy_last_accept, yy_last_len)
+		}
+		yy_match_pos, yy_match_cur, yy_match_more, yy_match_lineno = yy_pos, yy_cur, yy_more_len, yylineno
+
+`
+
+// goStateVar 是扫描器在匹配过程中修改的状态，普通模式下是包级变量，%option reentrant 时是yy_scanner的字段
+type goStateVar struct {
+	name  string
+	typ   string
+	value string //初始值，为空时使用零值
+}
+
+func (g *GoCodeGenerator) stateVars(tables *ScannerTables) []goStateVar {
+	vars := []goStateVar{
+		{"yyin", "io.Reader", "os.Stdin"},
+		{"yyout", "io.Writer", "os.Stdout"},
+		{"yytext", "string", ""},
+		{"yyleng", "int", ""},
+		{"yylineno", "int", "1"},
+		{"yytoken", "yy_token", ""},
+		{"yy_buffer", "[]byte", ""},
+		{"yy_pos", "int", ""},
+		{"yy_eof", "bool", ""},
+		{"yy_bol", "bool", ""},
+		{"yy_more_len", "int", ""},
+		{"yy_more_start", "yy_position", ""},
+		{"yy_cur", "yy_position", ""},
+		{"yy_start", "int", ""},
+		{"yy_start_stack", "[]int", ""},
+		{"yy_current_buffer", "*yy_buffer_state", ""},
+		{"yy_buffer_stack", "[]*yy_buffer_state", ""},
+	}
+	if tables.Reject {
+		vars = append(vars, goStateVar{"yy_states", "[]int", ""}, goStateVar{"yy_eols", "[]bool", ""})
+	}
+	if g.options.Reentrant {
+		//和flex的yyextra一样，用户可以在扫描器中保存自己的数据
+		vars = append(vars, goStateVar{"yyextra", g.options.ExtraType, ""})
+	}
+
+	return vars
+}
+
+func (g *GoCodeGenerator) writeTokenKinds(w *strings.Builder, tokens []*TokenDecl) {
+	/*
+		token的名称由用户声明，和开始条件一样不能替换前缀。
+		goyacc模式下这些名称就是goyacc根据语法文件中的%token生成的常量，
+		这里不能再定义一次，%token给出的值也被忽略，名称表直接使用goyacc的常量
+	*/
+	w.WriteString("//TokenKind 是%token声明的token种类，yylex返回它们的值\n")
+	w.WriteString("type TokenKind int\n\n")
+	if !g.options.GoYacc {
+		w.WriteString("const (\n")
+		for _, token := range tokens {
+			fmt.Fprintf(w, "\t%s TokenKind = %d\n", token.Name, token.Value)
+		}
+		w.WriteString(")\n\n")
+		tokens = uniqueTokenKinds(tokens)
+	}
+
+	w.WriteString(renamePrefix(g.options, "var yy_token_names = map[TokenKind]string{\n"))
+	for _, token := range tokens {
+		fmt.Fprintf(w, "\t%s: %q,\n", token.Name, token.Name)
+	}
+	w.WriteString("}\n\n")
+	w.WriteString(renamePrefix(g.options, `func (k TokenKind) String() string {
+	if name, ok := yy_token_names[k]; ok {
+		return name
+	}
+	return "TokenKind(" + yy_itoa(int(k)) + ")"
+}
+
+`))
+}
+
+func (g *GoCodeGenerator) Generate(w io.Writer, reader *LexReader, tables *ScannerTables) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "// Code generated by GoLex from %s. DO NOT EDIT.\n\n", reader.InputFileName)
+	fmt.Fprintf(&b, "package %s\n\n", g.options.Package)
+	b.WriteString("import (\n\t\"io\"\n\t\"os\"\n)\n\n")
+	if reader.HeaderCode != "" {
+		b.WriteString(reader.HeaderCode + "\n")
+	}
+
+	//规则名称是用户的正则表达式，不能替换其中的yy前缀
+	b.WriteString(renamePrefix(g.options, "var yy_rule_names = []string{") + quotedList(tables.RuleNames) + "}\n\n")
+
+	//开始条件的名称由用户声明，同样不能替换前缀
+	b.WriteString("const (\n")
+	for i, condition := range reader.StartConditions {
+		fmt.Fprintf(&b, "\t%s = %d\n", condition.Name, i)
+	}
+	b.WriteString(")\n\n")
+	if len(reader.Tokens) > 0 {
+		g.writeTokenKinds(&b, reader.Tokens)
+	}
+
+	var driver strings.Builder
+	if g.options.Reentrant {
+		g.writeScannerStruct(&driver, tables)
+	} else {
+		for _, v := range g.stateVars(tables) {
+			if v.value == "" {
+				fmt.Fprintf(&driver, "var %s %s\n", v.name, v.typ)
+			} else {
+				fmt.Fprintf(&driver, "var %s %s = %s\n", v.name, v.typ, v.value)
+			}
+		}
+		driver.WriteString("\n")
+	}
+	b.WriteString(renamePrefix(g.options, driver.String()))
+	driver.Reset()
+
+	driver.WriteString("const yy_F = -1\n")
+	fmt.Fprintf(&driver, "const yy_max_chars = %d\n", MAX_CHARS)
+	fmt.Fprintf(&driver, "const yy_tab_width = %d\n", g.options.TabWidth)
+	fmt.Fprintf(&driver, "const yy_read_size = %d\n", READ_SIZE)
+	fmt.Fprintf(&driver, "const yy_buf_size = %d\n", READ_SIZE)
+	fmt.Fprintf(&driver, "const yy_max_token = %d\n\n", g.options.MaxToken)
+	//每个开始条件的起始状态，以及在行首时使用的起始状态
+	fmt.Fprintf(&driver, "var yy_start_state = []int{%s}\n\n", intList(tables.Starts))
+	fmt.Fprintf(&driver, "var yy_bol_start_state = []int{%s}\n\n", intList(tables.BOLStarts))
+	//接收状态对应的规则编号，再通过yy_rule_action找到要执行的动作
+	fmt.Fprintf(&driver, "var yy_accept = []int{%s}\n\n", intList(tables.AcceptRule))
+	fmt.Fprintf(&driver, "var yy_accept_eol = []int{%s}\n\n", intList(tables.AcceptEOLRule))
+	fmt.Fprintf(&driver, "var yy_rule_action = []int{%s}\n\n", intList(tables.RuleActions))
+	if tables.Reject {
+		fmt.Fprintf(&driver, "var yy_accept_list = []int{%s}\n\n", intList(tables.AcceptList))
+		fmt.Fprintf(&driver, "var yy_accept_base = []int{%s}\n\n", intList(tables.AcceptBase))
+		fmt.Fprintf(&driver, "var yy_rule_eol = []int{%s}\n\n", intList(tables.RuleEOL))
+	}
+
+	next := "yy_trans[state][c]"
+	if tables.Trans != nil {
+		driver.WriteString("var yy_trans = [][]int{\n")
+		for _, row := range tables.Trans {
+			fmt.Fprintf(&driver, "\t{%s},\n", intList(row))
+		}
+		driver.WriteString("}\n")
+	} else {
+		next = "yy_rows[yy_rowmap[state]][c]"
+		fmt.Fprintf(&driver, "var yy_rowmap = []int{%s}\n\n", intList(tables.RowMap))
+		driver.WriteString("var yy_rows = [][]int{\n")
+		for _, row := range tables.Rows {
+			fmt.Fprintf(&driver, "\t{%s},\n", intList(row))
+		}
+		driver.WriteString("}\n")
+	}
+
+	/*
+		输入结束时先调用yywrap，yywrap由用户提供，返回false表示已经通过yyin设置了新的输入。
+		然后执行当前开始条件的<<EOF>>规则，动作中可以切换输入，没有<<EOF>>规则时yylex返回0
+	*/
+	var eof strings.Builder
+	userCode := make([]string, 0)
+	if !g.options.NoYYWrap {
+		wrap := "yywrap()"
+		if g.options.Reentrant {
+			//和flex一样，可重入的扫描器把自己传给yywrap
+			wrap = "yywrap(yyscanner)"
+		}
+		fmt.Fprintf(&eof, "\t\t\tif !%s {\n\t\t\t\tyy_delete_buffer(yy_current_buffer)\n\t\t\t\tcontinue\n\t\t\t}\n", wrap)
+	}
+	if eofActions := EOFActions(reader); len(eofActions) > 0 {
+		eof.WriteString("\t\t\tswitch yy_start {\n")
+		for _, action := range eofActions {
+			fmt.Fprintf(&eof, "\t\t\tcase %s:\n", strings.ReplaceAll(intList(action.Conditions), " ", ""))
+			if body := tokenActionBody(action.Action, "return int(%s)"); body != "" {
+				userCode = append(userCode, indentCode(body, "\t\t\t\t"))
+				eof.WriteString(userCodePlaceholder(len(userCode)-1) + "\n")
+			}
+			eof.WriteString("\t\t\t\tcontinue\n")
+		}
+		eof.WriteString("\t\t\t}\n")
+	}
+	eof.WriteString("\t\t\treturn 0")
+
+	lineNo := ""
+	lessLineNo := ""
+	if g.options.YYLineNo {
+		//yymore保留的部分已经统计过，yyless退回的部分要重新统计
+		lineNo = "\t\tfor _, c := range yytext[yy_more_len:] {\n\t\t\tif c == '\\n' {\n\t\t\t\tyylineno += 1\n\t\t\t}\n\t\t}\n"
+		lessLineNo = "\tfor _, c := range yytext[n:] {\n\t\tif c == '\\n' {\n\t\t\tyylineno -= 1\n\t\t}\n\t}\n"
+	}
+
+	//使用REJECT时记录匹配过程中的所有状态，动作中的REJECT跳回yy_find_rule选择下一个候选
+	rejectFunc, rejectVars, rejectReset, rejectRecord, rejectFind := "", "", "", "", ""
+	if tables.Reject {
+		rejectFunc = goRejectFunc
+		rejectVars = "\tvar yy_rejected bool\n\tvar yy_match_pos, yy_match_more, yy_match_lineno int\n\tvar yy_match_cur yy_position\n"
+		rejectReset = "\t\tyy_states = yy_states[:0]\n\t\tyy_eols = yy_eols[:0]\n"
+		rejectRecord = "\t\t\tyy_states = append(yy_states, state)\n\t\t\tyy_eols = append(yy_eols, yy_eol)\n"
+		rejectFind = goRejectFind
+	}
+
+	if g.options.Reentrant {
+		fmt.Fprintf(&driver, goReentrantAccessors, g.options.ExtraType, g.options.ExtraType)
+	}
+	if g.options.GoYacc || len(reader.Tokens) > 0 {
+		driver.WriteString(goItoaFunc)
+	}
+	param := ""
+	if g.options.GoYacc {
+		driver.WriteString(g.yaccLexer())
+		param = goYaccParam
+	}
+	fmt.Fprintf(&driver, goScannerDriver, next, lessLineNo, rejectFunc, param, rejectVars, eof.String(), rejectReset, g.options.MaxToken, rejectRecord, rejectFind, lineNo)
+	code := fillUserCode(renamePrefix(g.options, driver.String()), userCode)
+
+	for i, action := range tables.Actions {
+		code += fmt.Sprintf("\t\tcase %d:\n", i)
+		if body := tokenActionBody(action, "return int(%s)"); body != "" {
+			body = rejectPattern.ReplaceAllString(body, renamePrefix(g.options, "{ yy_rejected = true; goto yy_find_rule }"))
+			code += indentCode(body, "\t\t\t") + "\n"
+		}
+	}
+	code += "\t\t}\n\t}\n}\n"
+	if g.options.Reentrant {
+		//驱动代码和动作代码中对扫描器状态的引用都要改成yyscanner的字段
+		code = g.reentrant(code, tables)
+	}
+	b.WriteString(code)
+
+	if reader.UserCode != "" {
+		b.WriteString("\n" + reader.UserCode)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
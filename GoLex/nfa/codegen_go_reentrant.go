@@ -0,0 +1,207 @@
+package nfa
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+%option reentrant 时生成的go扫描器没有包级的可变状态，所有状态都是yy_scanner的字段，
+跳转表和规则名称只读，由所有扫描器共享，因此不同的goroutine可以同时使用各自的扫描器，例如:
+
+	yyscanner := yylex_init_extra(&result)
+	yyscanner.yyset_in(strings.NewReader(input))
+	for yyscanner.yylex() != 0 {
+	}
+
+驱动代码和普通模式相同，生成时把对状态的引用改成yyscanner的字段，把有状态的函数改成yy_scanner的方法，
+动作代码也做同样的改写，因此同一份规则文件在两种模式下都能使用，这和flex在c代码中使用宏的效果一样
+*/
+
+const goReentrantAccessors = `
+//yyget_extra 返回yylex_init_extra设置的用户数据
+func yyget_extra() %s {
+	return yyextra
+}
+
+func yyset_extra(extra %s) {
+	yyextra = extra
+}
+
+func yyget_in() io.Reader {
+	return yyin
+}
+
+//yyset_in 设置新的输入，之后的匹配从头读取r
+func yyset_in(r io.Reader) {
+	yyin = r
+	yy_current_buffer = nil
+	yy_buffer_stack = nil
+}
+
+func yyget_out() io.Writer {
+	return yyout
+}
+
+func yyset_out(w io.Writer) {
+	yyout = w
+}
+
+func yyget_text() string {
+	return yytext
+}
+
+func yyget_leng() int {
+	return yyleng
+}
+
+func yyget_lineno() int {
+	return yylineno
+}
+
+func yyset_lineno(n int) {
+	yylineno = n
+}
+`
+
+// 驱动代码中读写扫描器状态的函数，可重入时是yy_scanner的方法
+var goReentrantMethods = []string{
+	"ECHO", "BEGIN", "YY_START", "YY_CURRENT_BUFFER",
+	"yylex", "yyless", "unput", "yymore", "yy_fill", "yy_at_bol", "yy_next_match",
+	"yy_push_state", "yy_pop_state", "yy_top_state",
+	"yy_save_buffer_state", "yy_load_buffer_state", "yy_switch_to_buffer",
+	"yypush_buffer_state", "yypop_buffer_state", "yy_delete_buffer",
+	"yyget_extra", "yyset_extra", "yyget_in", "yyset_in", "yyget_out", "yyset_out",
+	"yyget_text", "yyget_leng", "yyget_lineno", "yyset_lineno",
+}
+
+func (g *GoCodeGenerator) writeScannerStruct(w *strings.Builder, tables *ScannerTables) {
+	vars := g.stateVars(tables)
+	width := 0
+	for _, v := range vars {
+		if len(v.name) > width {
+			width = len(v.name)
+		}
+	}
+
+	w.WriteString("//yy_scanner 是一个扫描器的全部状态，跳转表只读，由所有扫描器共享\n")
+	w.WriteString("type yy_scanner struct {\n")
+	for _, v := range vars {
+		fmt.Fprintf(w, "\t%-*s %s\n", width, v.name, v.typ)
+	}
+	w.WriteString("}\n\n")
+
+	w.WriteString("//yylex_init 创建一个扫描器，每个扫描器有自己的输入和状态，可以在不同的goroutine中同时使用\n")
+	w.WriteString("func yylex_init() *yy_scanner {\n\treturn &yy_scanner{\n")
+	for _, v := range vars {
+		if v.value != "" {
+			fmt.Fprintf(w, "\t\t%s: %s,\n", v.name, v.value)
+		}
+	}
+	w.WriteString("\t}\n}\n\n")
+
+	w.WriteString("//yylex_init_extra 创建一个扫描器并设置用户数据，动作中可以通过yyextra读取\n")
+	fmt.Fprintf(w, "func yylex_init_extra(extra %s) *yy_scanner {\n", g.options.ExtraType)
+	w.WriteString("\tyyscanner := yylex_init()\n\tyyscanner.yyextra = extra\n\treturn yyscanner\n}\n\n")
+}
+
+func (g *GoCodeGenerator) reentrant(code string, tables *ScannerTables) string {
+	/*
+		把代码中的状态变量改成yyscanner的字段，有状态的函数调用改成方法调用，函数定义改成yy_scanner的方法。
+		字符串，字符常量和注释中的内容保持不变，已经是选择器的标识符(例如b.buffer)也不改变。
+		代码已经替换过前缀，因此要匹配的名称也要替换前缀
+	*/
+	receiver := renamePrefix(g.options, "yyscanner")
+	fields := make(map[string]bool)
+	for _, v := range g.stateVars(tables) {
+		fields[renamePrefix(g.options, v.name)] = true
+	}
+	methods := make(map[string]bool)
+	for _, name := range goReentrantMethods {
+		methods[renamePrefix(g.options, name)] = true
+	}
+	if g.options.GoYacc {
+		//yy_scanner直接实现goyacc的yyLexer接口
+		methods["Lex"] = true
+		methods["Error"] = true
+	}
+
+	var b strings.Builder
+	afterFunc := false
+	for i := 0; i < len(code); {
+		c := code[i]
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			end := goLiteralEnd(code, i)
+			b.WriteString(code[i:end])
+			i = end
+			afterFunc = false
+		case strings.HasPrefix(code[i:], "//"):
+			end := strings.IndexByte(code[i:], '\n')
+			if end == -1 {
+				end = len(code) - i
+			}
+			b.WriteString(code[i : i+end])
+			i += end
+		case strings.HasPrefix(code[i:], "/*"):
+			end := strings.Index(code[i+2:], "*/")
+			if end == -1 {
+				end = len(code) - i - 4
+			}
+			b.WriteString(code[i : i+end+4])
+			i += end + 4
+		case isGoIdentChar(c) && (c < '0' || c > '9'):
+			j := i
+			for j < len(code) && isGoIdentChar(code[j]) {
+				j++
+			}
+			ident := code[i:j]
+			selector := i > 0 && code[i-1] == '.'
+			switch {
+			case afterFunc && methods[ident]:
+				fmt.Fprintf(&b, "(%s *%s) %s", receiver, renamePrefix(g.options, "yy_scanner"), ident)
+			case !afterFunc && !selector && (fields[ident] || methods[ident]):
+				b.WriteString(receiver + "." + ident)
+			default:
+				b.WriteString(ident)
+			}
+			afterFunc = ident == "func"
+			i = j
+		case c >= '0' && c <= '9':
+			//数字常量，例如0x1f中的x1f不是标识符
+			j := i
+			for j < len(code) && isGoIdentChar(code[j]) {
+				j++
+			}
+			b.WriteString(code[i:j])
+			i = j
+			afterFunc = false
+		default:
+			if c != ' ' && c != '\t' {
+				afterFunc = false
+			}
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	return b.String()
+}
+
+func goLiteralEnd(code string, start int) int {
+	//返回从start开始的字符串或字符常量之后的下标，`字符串中没有转义符
+	quote := code[start]
+	for i := start + 1; i < len(code); i++ {
+		if code[i] == '\\' && quote != '`' {
+			i++
+		} else if code[i] == quote {
+			return i + 1
+		}
+	}
+
+	return len(code)
+}
+
+func isGoIdentChar(c uint8) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
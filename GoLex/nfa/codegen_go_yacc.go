@@ -0,0 +1,53 @@
+package nfa
+
+import "fmt"
+
+/*
+%option goyacc 时生成的go扫描器实现goyacc生成的yyLexer接口:
+
+	type yyLexer interface {
+		Lex(lval *yySymType) int
+		Error(s string)
+	}
+
+和flex的bison-bridge一样，yylex多了一个参数lval，动作代码可以直接设置语法分析器需要的值，例如:
+
+	{D}+   { lval.num, _ = strconv.Atoi(yytext); return NUM }
+
+NUM等token常量由goyacc根据语法文件中的%token生成，扫描器和语法分析器放在同一个包中直接使用，
+不需要再手工定义。规则文件中用%token列出同样的名称之后，动作可以简写成 => NUM，
+TokenKind的String()也能输出这些名称，但是不会再定义这些常量，否则会和goyacc生成的常量重复。
+普通模式下通过yyParse(yy_lexer{})调用，可重入时yy_scanner本身就实现了yyLexer，例如yyParse(yylex_init())。
+设置了prefix时yySymType和goyacc -p一样使用新的前缀
+*/
+
+// goyacc把token的值放在lval中，yylex的参数和yySymType的名称都会替换前缀
+const goYaccParam = "lval *yySymType"
+
+const goYaccLexer = `
+//String 返回 行:列 形式的位置，用于错误信息
+func (p yy_position) String() string {
+	return yy_itoa(p.Line) + ":" + yy_itoa(p.Column)
+}
+
+//Lex 返回下一个token，输入结束时返回0
+func %sLex(lval *yySymType) int {
+	return yylex(lval)
+}
+
+//Error 输出语法分析器报告的错误以及最近一个token的位置
+func %sError(s string) {
+	os.Stderr.WriteString(yytoken.Start.String() + ": " + s + "\n")
+}
+`
+
+func (g *GoCodeGenerator) yaccLexer() string {
+	//可重入时Lex和Error由reentrant改成yy_scanner的方法，否则是yy_lexer的方法
+	if g.options.Reentrant {
+		return fmt.Sprintf(goYaccLexer, "", "")
+	}
+
+	receiver := "(yy_lexer) "
+	return "\n//yy_lexer 实现goyacc的yyLexer接口，扫描器的状态都是包级变量，因此yy_lexer没有字段\ntype yy_lexer struct{}\n" +
+		fmt.Sprintf(goYaccLexer, receiver, receiver)
+}
@@ -0,0 +1,480 @@
+package nfa
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type PythonCodeGenerator struct {
+	options *LexOptions
+}
+
+const pythonScannerDriver = `
+def yy_next(state, c):
+    if c >= yy_max_chars:
+        return yy_F
+    return %s
+
+
+def ECHO():
+    yyout.write(yytext)
+
+
+class yy_position:
+    # 输入中的一个位置，offset从0开始，line和column从1开始
+    def __init__(self, offset, line, column):
+        self.offset = offset
+        self.line = line
+        self.column = column
+
+    def advance(self, text):
+        offset, line, column = self.offset + len(text), self.line, self.column
+        for c in text:
+            if c == "\n":
+                line += 1
+                column = 1
+            elif c == "\t":
+                column = ((column - 1) // yy_tab_width + 1) * yy_tab_width + 1
+            else:
+                column += 1
+        return yy_position(offset, line, column)
+
+
+class yy_token:
+    # 最近一次匹配的结果，执行动作代码时可以通过yytoken读取
+    def __init__(self, rule, name, lexeme, start, end):
+        self.rule = rule
+        self.name = name
+        self.lexeme = lexeme
+        self.start = start
+        self.end = end
+
+
+def yy_at_bol():
+    if yy_pos == 0:
+        return yy_bol
+    return yy_buffer[yy_pos - 1] == "\n"
+
+
+def yy_fill():
+    # 读入更多的输入，已经处理过的字符从缓冲区中删除，输入结束时返回False
+    global yy_buffer, yy_pos, yy_eof, yy_bol
+    if yy_eof:
+        return False
+    keep = yy_pos - yy_more_len
+    if keep > 0:
+        yy_bol = yy_at_bol()
+        yy_buffer = yy_buffer[keep:]
+        yy_pos -= keep
+    data = yyin.read(yy_read_size)
+    if data == "":
+        yy_eof = True
+        return False
+    yy_buffer += data
+    return True
+
+
+def yy_fatal_error(msg):
+    sys.stderr.write(msg + "\n")
+    sys.exit(2)
+
+
+def yyless(n):
+    # 只保留yytext的前n个字符，其余的字符退回输入重新匹配
+    global yytext, yyleng, yylineno, yy_pos, yy_cur
+%s    yy_pos -= yyleng - n
+    yytext = yytext[:n]
+    yyleng = n
+    yytoken.lexeme = yytext
+    yy_cur = yytoken.start.advance(yytext)
+    yytoken.end = yy_cur
+
+
+def unput(c):
+    # 把字符c退回输入，下一次匹配从c开始
+    global yy_buffer
+    yy_buffer = yy_buffer[:yy_pos] + c + yy_buffer[yy_pos:]
+
+
+def yymore():
+    # 让下一次匹配的字符串接在yytext后面，而不是替换yytext
+    global yy_more_len, yy_more_start
+    yy_more_len = yyleng
+    yy_more_start = yytoken.start
+
+
+def BEGIN(c):
+    # 切换开始条件，之后只匹配在该开始条件下有效的规则
+    global yy_start
+    yy_start = c
+
+
+def YY_START():
+    return yy_start
+
+
+def yy_push_state(c):
+    # 把当前开始条件压栈，然后切换到开始条件c
+    global yy_start
+    yy_start_stack.append(yy_start)
+    yy_start = c
+
+
+def yy_pop_state():
+    # 切换到栈顶的开始条件并把它出栈
+    global yy_start
+    if not yy_start_stack:
+        yy_fatal_error("start-condition stack underflow")
+    yy_start = yy_start_stack.pop()
+
+
+def yy_top_state():
+    # 返回栈顶的开始条件，不改变当前开始条件
+    if not yy_start_stack:
+        yy_fatal_error("start-condition stack underflow")
+    return yy_start_stack[-1]
+
+
+class yy_buffer_state:
+    # 一个输入的读取状态，正在读取的输入的状态保存在yy_buffer等变量中
+    def __init__(self, file):
+        self.input = file
+        self.buffer = ""
+        self.pos = 0
+        self.eof = False
+        self.bol = True
+        self.cur = yy_position(0, 1, 1)
+
+
+def yy_create_buffer(file):
+    return yy_buffer_state(file)
+
+
+def yy_save_buffer_state():
+    b = yy_current_buffer
+    if b is not None:
+        b.input, b.buffer, b.pos, b.eof, b.bol, b.cur = yyin, yy_buffer, yy_pos, yy_eof, yy_bol, yy_cur
+
+
+def yy_load_buffer_state():
+    global yyin, yy_buffer, yy_pos, yy_eof, yy_bol, yy_cur, yy_more_len
+    b = yy_current_buffer
+    yyin, yy_buffer, yy_pos, yy_eof, yy_bol, yy_cur = b.input, b.buffer, b.pos, b.eof, b.bol, b.cur
+    yy_more_len = 0
+
+
+def yy_switch_to_buffer(b):
+    # 之后从b读取输入，原来的输入停在当前位置，可以再切换回去
+    global yy_current_buffer
+    yy_save_buffer_state()
+    yy_current_buffer = b
+    yy_load_buffer_state()
+
+
+def yypush_buffer_state(b):
+    # 暂停当前的输入转而读取b，yypop_buffer_state之后恢复原来的输入
+    global yy_current_buffer
+    yy_save_buffer_state()
+    if yy_current_buffer is not None:
+        yy_buffer_stack.append(yy_current_buffer)
+    yy_current_buffer = b
+    yy_load_buffer_state()
+
+
+def yypop_buffer_state():
+    # 丢弃当前的输入，恢复被yypush_buffer_state暂停的输入，没有时YY_CURRENT_BUFFER返回None
+    global yy_current_buffer
+    yy_current_buffer = None
+    if yy_buffer_stack:
+        yy_current_buffer = yy_buffer_stack.pop()
+        yy_load_buffer_state()
+
+
+def yy_delete_buffer(b):
+    global yy_current_buffer
+    if b is yy_current_buffer:
+        yy_current_buffer = None
+    b.buffer = ""
+
+
+def YY_CURRENT_BUFFER():
+    return yy_current_buffer
+
+
+def yy_scan():
+    # 从当前开始条件的起始状态开始尽可能多地读取字符，返回最后一次进入接收状态时的规则和长度，行首时从另一个起始状态开始
+%s    state = yy_start_state[yy_start]
+    if yy_at_bol():
+        state = yy_bol_start_state[yy_start]
+    yy_last_accept = -1
+    yy_last_len = 1
+    n = 0
+    while True:
+        state = yy_next(state, ord(yy_buffer[yy_pos + n]))
+        if state == yy_F:
+            break
+        if n >= yy_max_token:
+            if yy_last_accept != -1:
+                # 超出长度之前已经有规则接收，使用最长的那个匹配
+                break
+            yy_fatal_error("token too long, exceeds maxtoken=%d")
+        if yy_pos + n + 1 == len(yy_buffer):
+            yy_fill()
+        yy_end = yy_pos + n + 1 == len(yy_buffer)
+        yy_eol = yy_end or yy_buffer[yy_pos + n + 1] in "\r\n"
+%s        yy_act = yy_accept[state]
+        if yy_eol:
+            # 下一个字符是换行符或者输入已经结束，$结尾的规则可以接收
+            yy_act = yy_accept_eol[state]
+        if yy_act != -1:
+            yy_last_accept = yy_act
+            yy_last_len = n + 1
+        if yy_end:
+            break
+        n += 1
+    return yy_last_accept, yy_last_len
+
+
+%sdef yylex():
+    global yytext, yyleng, yylineno, yytoken, yy_buffer, yy_pos, yy_eof, yy_bol, yy_more_len, yy_cur
+%s    while True:
+        if yy_current_buffer is None:
+            yy_switch_to_buffer(yy_create_buffer(yyin))
+
+%s        %s yy_pos == len(yy_buffer) and not yy_fill():
+%s
+        else:
+            yy_last_accept, yy_last_len = yy_scan()
+%s
+        if yy_last_accept == -1:
+            # 没有规则能够匹配，把当前字符原样输出
+            yyout.write(yy_buffer[yy_pos])
+            yy_cur = yy_cur.advance(yy_buffer[yy_pos])
+            yy_pos += 1
+            continue
+
+        yytext = yy_buffer[yy_pos - yy_more_len:yy_pos + yy_last_len]
+        yyleng = len(yytext)
+        yy_token_start = yy_more_start if yy_more_len > 0 else yy_cur
+        yy_cur = yy_cur.advance(yy_buffer[yy_pos:yy_pos + yy_last_len])
+        yytoken = yy_token(yy_last_accept, yy_rule_names[yy_last_accept], yytext, yy_token_start, yy_cur)
+        yy_pos += yy_last_len
+%s        yy_more_len = 0
+        yy_act = yy_rule_action[yy_last_accept]
+`
+
+const pythonRejectFunc = `yy_states = []
+yy_eols = []
+
+
+class yy_reject(Exception):
+    pass
+
+
+def yy_next_match(rule, length):
+    # 返回REJECT之后的下一个候选: 同样长度下排在后面的规则，或者更短的匹配
+    while length > 0:
+        state = yy_states[length - 1]
+        for r in yy_accept_list[yy_accept_base[state]:yy_accept_base[state + 1]]:
+            if r > rule and (yy_rule_eol[r] == 0 or yy_eols[length - 1]):
+                return r, length
+        rule = -1
+        length -= 1
+    return -1, 1
+
+
+`
+
+const pythonRejectFind = `        if yy_rejected:
+            yy_rejected = False
+            yy_pos, yy_cur, yy_more_len, yylineno = yy_match
+            yy_last_accept, yy_last_len = yy_next_match(yy_last_accept, yy_last_len)
+`
+
+func (g *PythonCodeGenerator) writeTokenKinds(w *strings.Builder, tokens []*TokenDecl) {
+	/*
+		TokenKind是IntEnum，动作返回的值可以直接和整数比较，str()返回token的名称。
+		每个token同时定义成模块级的常量，动作中可以直接写 return FCON
+	*/
+	w.WriteString("import enum\n\n\nclass TokenKind(enum.IntEnum):\n")
+	for _, token := range tokens {
+		fmt.Fprintf(w, "    %s = %d\n", token.Name, token.Value)
+	}
+	w.WriteString("\n    def __str__(self):\n        return self.name\n\n\n")
+	for _, token := range tokens {
+		fmt.Fprintf(w, "%s = TokenKind.%s\n", token.Name, token.Name)
+	}
+
+	names := make([]string, 0, len(tokens))
+	for _, token := range uniqueTokenKinds(tokens) {
+		names = append(names, fmt.Sprintf("%d: %q", token.Value, token.Name))
+	}
+	w.WriteString(renamePrefix(g.options, "yy_token_names = {") + strings.Join(names, ", ") + "}\n\n")
+}
+
+func (g *PythonCodeGenerator) Generate(w io.Writer, reader *LexReader, tables *ScannerTables) error {
+	if g.options.Reentrant {
+		//状态都在yy_scanner中的扫描器目前只有go代码生成器支持
+		return fmt.Errorf("reentrant is only supported by the go backend")
+	}
+	if g.options.GoYacc {
+		return fmt.Errorf("goyacc is only supported by the go backend")
+	}
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Code generated by GoLex from %s. DO NOT EDIT.\n\n", reader.InputFileName)
+	b.WriteString("import sys\n\n")
+	if reader.HeaderCode != "" {
+		//python对缩进敏感，头部代码要去掉公共的缩进
+		b.WriteString(dedent(reader.HeaderCode) + "\n")
+	}
+
+	//规则名称是用户的正则表达式，不能替换其中的yy前缀
+	b.WriteString(renamePrefix(g.options, "yy_rule_names = [") + quotedList(tables.RuleNames) + "]\n\n")
+
+	//开始条件的名称由用户声明，同样不能替换前缀
+	for i, condition := range reader.StartConditions {
+		fmt.Fprintf(&b, "%s = %d\n", condition.Name, i)
+	}
+	b.WriteString("\n")
+	if len(reader.Tokens) > 0 {
+		g.writeTokenKinds(&b, reader.Tokens)
+	}
+
+	var driver strings.Builder
+	driver.WriteString("yyin = sys.stdin\n")
+	driver.WriteString("yyout = sys.stdout\n")
+	driver.WriteString("yytext = \"\"\n")
+	driver.WriteString("yyleng = 0\n")
+	driver.WriteString("yylineno = 1\n")
+	driver.WriteString("yy_buffer = \"\"\n")
+	driver.WriteString("yy_pos = 0\n")
+	driver.WriteString("yy_eof = False\n")
+	driver.WriteString("yy_bol = True\n")
+	driver.WriteString("yy_more_len = 0\n")
+	driver.WriteString("yy_more_start = None\n")
+	driver.WriteString("yy_cur = None\n")
+	driver.WriteString("yytoken = None\n")
+	driver.WriteString("yy_start = 0\n")
+	driver.WriteString("yy_start_stack = []\n")
+	driver.WriteString("yy_current_buffer = None\n")
+	driver.WriteString("yy_buffer_stack = []\n\n")
+	driver.WriteString("yy_F = -1\n")
+	fmt.Fprintf(&driver, "yy_max_chars = %d\n", MAX_CHARS)
+	fmt.Fprintf(&driver, "yy_tab_width = %d\n", g.options.TabWidth)
+	fmt.Fprintf(&driver, "yy_read_size = %d\n", READ_SIZE)
+	fmt.Fprintf(&driver, "yy_max_token = %d\n\n", g.options.MaxToken)
+	//每个开始条件的起始状态，以及在行首时使用的起始状态
+	fmt.Fprintf(&driver, "yy_start_state = [%s]\n\n", intList(tables.Starts))
+	fmt.Fprintf(&driver, "yy_bol_start_state = [%s]\n\n", intList(tables.BOLStarts))
+	//接收状态对应的规则编号，再通过yy_rule_action找到要执行的动作
+	fmt.Fprintf(&driver, "yy_accept = [%s]\n\n", intList(tables.AcceptRule))
+	fmt.Fprintf(&driver, "yy_accept_eol = [%s]\n\n", intList(tables.AcceptEOLRule))
+	fmt.Fprintf(&driver, "yy_rule_action = [%s]\n\n", intList(tables.RuleActions))
+	if tables.Reject {
+		fmt.Fprintf(&driver, "yy_accept_list = [%s]\n\n", intList(tables.AcceptList))
+		fmt.Fprintf(&driver, "yy_accept_base = [%s]\n\n", intList(tables.AcceptBase))
+		fmt.Fprintf(&driver, "yy_rule_eol = [%s]\n\n", intList(tables.RuleEOL))
+	}
+
+	next := "yy_trans[state][c]"
+	if tables.Trans != nil {
+		driver.WriteString("yy_trans = [\n")
+		for _, row := range tables.Trans {
+			fmt.Fprintf(&driver, "    [%s],\n", intList(row))
+		}
+		driver.WriteString("]\n")
+	} else {
+		next = "yy_rows[yy_rowmap[state]][c]"
+		fmt.Fprintf(&driver, "yy_rowmap = [%s]\n\n", intList(tables.RowMap))
+		driver.WriteString("yy_rows = [\n")
+		for _, row := range tables.Rows {
+			fmt.Fprintf(&driver, "    [%s],\n", intList(row))
+		}
+		driver.WriteString("]\n")
+	}
+
+	/*
+		输入结束时先调用yywrap，yywrap由用户提供，返回False表示已经通过yyin设置了新的输入。
+		然后执行当前开始条件的<<EOF>>规则，动作中可以切换输入，没有<<EOF>>规则时yylex返回0
+	*/
+	var eof strings.Builder
+	userCode := make([]string, 0)
+	if !g.options.NoYYWrap {
+		eof.WriteString("            if not yywrap():\n                yy_delete_buffer(yy_current_buffer)\n                continue\n")
+	}
+	for i, action := range EOFActions(reader) {
+		keyword := "elif"
+		if i == 0 {
+			keyword = "if"
+		}
+		conditions := intList(action.Conditions)
+		if len(action.Conditions) == 1 {
+			conditions += ","
+		}
+		fmt.Fprintf(&eof, "            %s yy_start in (%s):\n", keyword, conditions)
+		if body := tokenActionBody(action.Action, "return %s"); body != "" {
+			userCode = append(userCode, indentCode(body, "                "))
+			eof.WriteString(userCodePlaceholder(len(userCode)-1) + "\n")
+		}
+		eof.WriteString("                continue\n")
+	}
+	eof.WriteString("            return 0")
+
+	lineNo := ""
+	lessLineNo := ""
+	if g.options.YYLineNo {
+		//yymore保留的部分已经统计过，yyless退回的部分要重新统计
+		lineNo = "        yylineno += yytext[yy_more_len:].count(\"\\n\")\n"
+		lessLineNo = "    yylineno -= yytext[n:].count(\"\\n\")\n"
+	}
+
+	/*
+		使用REJECT时记录匹配过程中的所有状态。python没有goto，动作中的REJECT抛出yy_reject异常，
+		下一轮循环不再扫描，直接从记录的状态中选择下一个候选
+	*/
+	rejectReset, rejectRecord, rejectFunc, rejectVars, rejectFind, eofKeyword, rejectSave := "", "", "", "", "", "if", ""
+	if tables.Reject {
+		rejectReset = "    del yy_states[:]\n    del yy_eols[:]\n"
+		rejectRecord = "        yy_states.append(state)\n        yy_eols.append(yy_eol)\n"
+		rejectFunc = pythonRejectFunc
+		rejectVars = "    yy_rejected = False\n"
+		rejectFind = pythonRejectFind
+		eofKeyword = "elif"
+		rejectSave = "        yy_match = (yy_pos, yy_cur, yy_more_len, yylineno)\n"
+	}
+
+	fmt.Fprintf(&driver, pythonScannerDriver, next, lessLineNo, rejectReset, g.options.MaxToken, rejectRecord, rejectFunc, rejectVars, rejectFind, eofKeyword, eof.String(), rejectSave, lineNo)
+	b.WriteString(fillUserCode(renamePrefix(g.options, driver.String()), userCode))
+
+	indent := "        "
+	if tables.Reject {
+		b.WriteString("        try:\n")
+		indent = "            "
+	}
+	for i, action := range tables.Actions {
+		keyword := "elif"
+		if i == 0 {
+			keyword = "if"
+		}
+		fmt.Fprintf(&b, "%s%s %s == %d:\n", indent, keyword, renamePrefix(g.options, "yy_act"), i)
+		body := tokenActionBody(action, "return %s")
+		if body == "" {
+			body = "pass"
+		}
+		body = rejectPattern.ReplaceAllString(body, renamePrefix(g.options, "raise yy_reject()"))
+		b.WriteString(indentCode(body, indent+"    ") + "\n")
+	}
+	if tables.Reject {
+		b.WriteString(renamePrefix(g.options, "        except yy_reject:\n            yy_rejected = True\n"))
+	}
+
+	if reader.UserCode != "" {
+		b.WriteString("\n\n" + reader.UserCode)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
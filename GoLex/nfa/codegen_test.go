@@ -0,0 +1,771 @@
+package nfa
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func generateScanner(t *testing.T, spec string, outputName string) (string, *LexReader) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.lex")
+	require.Nil(t, os.WriteFile(input, []byte(spec), 0644))
+	lexReader, err := NewLexReader(input, filepath.Join(dir, outputName))
+	require.Nil(t, err)
+	lexReader.Head()
+	parser, _ := NewRegParser(lexReader)
+	rules := parser.ParseAST()
+	starts := NewAstNfaConverter().MakeNFAs(rules, lexReader.StartConditions)
+
+	converter := NewNfaDfaConverter()
+	converter.Verbose = false
+	converter.Options = lexReader.Options
+	converter.MakeDTranFrom(starts)
+	converter.MinimizeDFA()
+
+	output, err := lexReader.CreateOutput()
+	require.Nil(t, err)
+	defer output.Close()
+	generator := NewCodeGenerator(lexReader.Options)
+	require.Nil(t, generator.Generate(output, lexReader, converter.Tables(rules)))
+	return lexReader.OutputFileName, lexReader
+}
+
+func runScanner(t *testing.T, stdin string, name string, args ...string) string {
+	if _, err := exec.LookPath(name); err != nil {
+		t.Skipf("%s not installed", name)
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	require.Nil(t, cmd.Run(), out.String())
+	return out.String()
+}
+
+const goScannerSpec = `%option noyywrap package=main tables=compressed
+%{
+import "fmt"
+%}
+D  [0-9]
+%%
+if        { fmt.Print("IF") }
+{D}+      { fmt.Printf("NUM(%s)", yytext) }
+[a-z]+    {
+              fmt.Printf("ID(%s)", yytext)
+          }
+%%
+func main() {
+	yylex()
+}
+`
+
+func TestGenerateGoScanner(t *testing.T) {
+	file, _ := generateScanner(t, goScannerSpec, "scanner.go")
+	dir := filepath.Dir(file)
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module scanner\n\ngo 1.19\n"), 0644))
+	out := runScanner(t, "if x1 23 iff", "go", "run", file)
+	require.Equal(t, "IF ID(x)NUM(1) NUM(23) ID(iff)", out)
+}
+
+const pythonScannerSpec = `%option noyywrap yylineno
+D  [0-9]
+%%
+{D}+      { print("NUM(%s)" % yytext, end="") }
+\n        {
+              print("<%d>" % yylineno, end="")
+          }
+%%
+yylex()
+`
+
+func TestGeneratePythonScanner(t *testing.T) {
+	file, _ := generateScanner(t, pythonScannerSpec, "scanner.py")
+	out := runScanner(t, "a1\n22\n", "python3", file)
+	require.Equal(t, "aNUM(1)<2>NUM(22)<3>", out)
+}
+
+const cScannerSpec = `%option prefix=calc
+%{
+#include <stdio.h>
+%}
+%%
+[0-9]+    { printf("NUM(%s)", calctext); }
+"+"       ECHO;
+%%
+int calcwrap(void) { return 1; }
+int main(void) { calclex(); return 0; }
+`
+
+func TestGenerateCScanner(t *testing.T) {
+	file, reader := generateScanner(t, cScannerSpec, "scanner.c")
+	require.Equal(t, "calc", reader.Options.Prefix)
+	binary := filepath.Join(filepath.Dir(file), "scanner")
+	runScanner(t, "", "cc", "-o", binary, file)
+	out := runScanner(t, "1+23 ", binary)
+	require.Equal(t, "NUM(1)+NUM(23) ", out)
+}
+
+func TestLexOptions(t *testing.T) {
+	options := NewLexOptions()
+	require.Nil(t, options.Set("backend=go"))
+	require.Nil(t, options.Set("tables=compressed"))
+	require.Nil(t, options.Set("noyywrap"))
+	require.Nil(t, options.Set("outfile=\"lex.yy.go\""))
+	require.Nil(t, options.Set("nosimplify"))
+	require.Equal(t, BACKEND_GO, options.Backend)
+	require.Equal(t, TABLES_COMPRESSED, options.Tables)
+	require.True(t, options.NoYYWrap)
+	require.False(t, options.Simplify)
+	require.Equal(t, "lex.yy.go", options.OutFile)
+	require.NotNil(t, options.Set("backend=rust"))
+	require.NotNil(t, options.Set("bogus"))
+}
+
+func TestOutfileSelectsBackend(t *testing.T) {
+	//命令行给出的是output.py，%option outfile=scanner.go 之后生成go代码，除非明确指定了backend
+	outfile := filepath.Join(t.TempDir(), "scanner.go")
+	file, reader := generateScanner(t, "%option noyywrap outfile="+outfile+"\n%%\na   {}\n%%\nfunc main() {}\n", "output.py")
+	require.Equal(t, BACKEND_GO, reader.Options.Backend)
+	require.Equal(t, outfile, file)
+	source, err := os.ReadFile(file)
+	require.Nil(t, err)
+	require.Contains(t, string(source), "func yylex() int {")
+
+	options := NewLexOptions()
+	require.Nil(t, options.Set("backend=c"))
+	require.Nil(t, options.Set("outfile=lex.yy.go"))
+	require.Equal(t, BACKEND_C, options.Backend)
+	options = NewLexOptions()
+	require.Nil(t, options.Set("outfile=lex.yy.c"))
+	require.Equal(t, BACKEND_C, options.Backend)
+}
+
+const anchorScannerSpec = `%option noyywrap
+%%
+^#[a-z]+    { print("DIR(%s)" % yytext, end="") }
+[a-z]+$     { print("END(%s)" % yytext, end="") }
+[a-z]+      { print("W(%s)" % yytext, end="") }
+#           { print("HASH", end="") }
+%%
+yylex()
+`
+
+func TestGenerateAnchors(t *testing.T) {
+	file, _ := generateScanner(t, anchorScannerSpec, "scanner.py")
+	out := runScanner(t, "#if a #b\nab cd\n#x", "python3", file)
+	require.Equal(t, "DIR(#if) W(a) HASHEND(b)\nW(ab) END(cd)\nDIR(#x)", out)
+
+	cSpec := strings.ReplaceAll(anchorScannerSpec, "print(\"", "printf(\"")
+	cSpec = strings.ReplaceAll(cSpec, "\" % yytext, end=\"\")", "\", yytext);")
+	cSpec = strings.ReplaceAll(cSpec, ", end=\"\")", ");")
+	cSpec = strings.ReplaceAll(cSpec, "yylex()", "int main(void) { yylex(); return 0; }")
+	file, _ = generateScanner(t, cSpec, "scanner.c")
+	binary := filepath.Join(filepath.Dir(file), "scanner")
+	runScanner(t, "", "cc", "-o", binary, file)
+	out = runScanner(t, "#if a #b\nab cd\n#x", binary)
+	require.Equal(t, "DIR(#if) W(a) HASHEND(b)\nW(ab) END(cd)\nDIR(#x)", out)
+}
+
+const goTokenSpec = `%option noyywrap package=main tabwidth=4
+%{
+import "fmt"
+%}
+%%
+[a-z]+      { fmt.Printf("%s:%d-%d:%d:%d ", yytoken.Name, yytoken.Start.Offset, yytoken.End.Offset, yytoken.Start.Line, yytoken.Start.Column) }
+[ \t\n]     {}
+%%
+func main() {
+	yylex()
+}
+`
+
+func TestGenerateTokenPositions(t *testing.T) {
+	expected := "[a-z]+:0-2:1:1 [a-z]+:4-5:1:9 [a-z]+:6-9:2:1 "
+
+	file, _ := generateScanner(t, goTokenSpec, "scanner.go")
+	require.Nil(t, os.WriteFile(filepath.Join(filepath.Dir(file), "go.mod"), []byte("module scanner\n\ngo 1.19\n"), 0644))
+	require.Equal(t, expected, runScanner(t, "ab\t\tc\nxyz", "go", "run", file))
+
+	pythonSpec := "%option noyywrap tabwidth=4\n%%\n" +
+		"[a-z]+      { print(\"%s:%d-%d:%d:%d \" % (yytoken.name, yytoken.start.offset, yytoken.end.offset, yytoken.start.line, yytoken.start.column), end=\"\") }\n" +
+		"[ \\t\\n]     {}\n%%\nyylex()\n"
+	file, _ = generateScanner(t, pythonSpec, "scanner.py")
+	require.Equal(t, expected, runScanner(t, "ab\t\tc\nxyz", "python3", file))
+
+	cSpec := "%option noyywrap tabwidth=4\n%%\n" +
+		"[a-z]+      { printf(\"%s:%ld-%ld:%d:%d \", yytoken.name, yytoken.start.offset, yytoken.end.offset, yytoken.start.line, yytoken.start.column); }\n" +
+		"[ \\t\\n]     {}\n%%\nint main(void) { yylex(); return 0; }\n"
+	file, _ = generateScanner(t, cSpec, "scanner.c")
+	binary := filepath.Join(filepath.Dir(file), "scanner")
+	runScanner(t, "", "cc", "-o", binary, file)
+	require.Equal(t, expected, runScanner(t, "ab\t\tc\nxyz", binary))
+}
+
+const goPushbackSpec = `%option noyywrap package=main maxtoken=16
+%{
+import "fmt"
+%}
+%%
+ab          { fmt.Printf("[%s]", yytext); yyless(1) }
+[0-9]       { fmt.Print("#"); unput('z') }
+more        { yymore() }
+!           { fmt.Printf("{%s}", yytext) }
+-+          {}
+@[a-z]+;    {}
+[a-z]       { fmt.Printf("(%s)", yytext) }
+%%
+func main() {
+	yylex()
+}
+`
+
+const pythonPushbackSpec = `%option noyywrap maxtoken=16
+%%
+ab          { print("[%s]" % yytext, end=""); yyless(1) }
+[0-9]       { print("#", end=""); unput("z") }
+more        { yymore() }
+!           { print("{%s}" % yytext, end="") }
+-+          {}
+@[a-z]+;    {}
+[a-z]       { print("(%s)" % yytext, end="") }
+%%
+yylex()
+`
+
+const cPushbackSpec = `%option noyywrap maxtoken=16
+%%
+ab          { printf("[%s]", yytext); yyless(1); }
+[0-9]       { printf("#"); unput('z'); }
+more        { yymore(); }
+!           { printf("{%s}", yytext); }
+-+          {}
+@[a-z]+;    {}
+[a-z]       { printf("(%s)", yytext); }
+%%
+int main(void) { yylex(); return 0; }
+`
+
+func TestGeneratePushback(t *testing.T) {
+	//输入比一次读入的长度长，扫描器需要多次补充缓冲区
+	spaces := strings.Repeat(" ", 2*READ_SIZE+1)
+	input := "ab1more!" + spaces + "ab"
+	expected := "[ab](b)#(z){more!}" + spaces + "[ab](b)"
+
+	file, _ := generateScanner(t, goPushbackSpec, "scanner.go")
+	require.Nil(t, os.WriteFile(filepath.Join(filepath.Dir(file), "go.mod"), []byte("module scanner\n\ngo 1.19\n"), 0644))
+	require.Equal(t, expected, runScanner(t, input, "go", "run", file))
+	require.Equal(t, "(x)", runScanner(t, strings.Repeat("-", 20)+"x", "go", "run", file))
+
+	file, _ = generateScanner(t, pythonPushbackSpec, "scanner.py")
+	require.Equal(t, expected, runScanner(t, input, "python3", file))
+	//超出长度之前-+已经接收了16个字符，@[a-z]+;直到;才能接收
+	require.Equal(t, "(x)", runScanner(t, strings.Repeat("-", 20)+"x", "python3", file))
+	_, err := runFailingScanner(t, "@"+strings.Repeat("a", 20)+";", "python3", file)
+	require.Contains(t, err, "token too long, exceeds maxtoken=16")
+
+	file, _ = generateScanner(t, cPushbackSpec, "scanner.c")
+	binary := filepath.Join(filepath.Dir(file), "scanner")
+	runScanner(t, "", "cc", "-o", binary, file)
+	require.Equal(t, expected, runScanner(t, input, binary))
+	require.Equal(t, "(x)", runScanner(t, strings.Repeat("-", 20)+"x", binary))
+	_, err = runFailingScanner(t, "@"+strings.Repeat("a", 20)+";", binary)
+	require.Contains(t, err, "token too long, exceeds maxtoken=16")
+}
+
+func runFailingScanner(t *testing.T, stdin string, name string, args ...string) (string, string) {
+	//扫描器应该以非0状态退出，返回标准输出和标准错误的内容
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var out, errOut bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+	require.NotNil(t, cmd.Run(), out.String())
+	return out.String(), errOut.String()
+}
+
+const pythonRejectSpec = `%option noyywrap
+%%
+abc     { print("ABC", end=""); REJECT }
+ab      { print("AB", end=""); REJECT }
+a       { print("A", end="") }
+c$      { print("C$", end=""); REJECT }
+[a-z]   { print("L", end="") }
+%%
+yylex()
+`
+
+func TestGenerateReject(t *testing.T) {
+	//REJECT先选择同样长度下的其他规则，再选择更短的匹配
+	input := "abc\nabcd"
+	expected := "ABCABALC$L\nABCABALLL"
+
+	file, _ := generateScanner(t, pythonRejectSpec, "scanner.py")
+	require.Equal(t, expected, runScanner(t, input, "python3", file))
+
+	goSpec := strings.ReplaceAll(pythonRejectSpec, ", end=\"\")", ")")
+	goSpec = strings.ReplaceAll(goSpec, "print(", "fmt.Print(")
+	goSpec = strings.ReplaceAll(goSpec, "%option noyywrap", "%option noyywrap package=main\n%{\nimport \"fmt\"\n%}")
+	goSpec = strings.ReplaceAll(goSpec, "yylex()", "func main() {\n\tyylex()\n}")
+	file, _ = generateScanner(t, goSpec, "scanner.go")
+	require.Nil(t, os.WriteFile(filepath.Join(filepath.Dir(file), "go.mod"), []byte("module scanner\n\ngo 1.19\n"), 0644))
+	require.Equal(t, expected, runScanner(t, input, "go", "run", file))
+
+	cSpec := strings.ReplaceAll(pythonRejectSpec, ", end=\"\")", ");")
+	cSpec = strings.ReplaceAll(cSpec, "print(", "printf(")
+	cSpec = strings.ReplaceAll(cSpec, "yylex()", "int main(void) { yylex(); return 0; }")
+	file, _ = generateScanner(t, cSpec, "scanner.c")
+	binary := filepath.Join(filepath.Dir(file), "scanner")
+	runScanner(t, "", "cc", "-o", binary, file)
+	require.Equal(t, expected, runScanner(t, input, binary))
+}
+
+const pythonEOFSpec = `%option noyywrap
+%{
+import io
+%}
+%x STR
+%%
+\"           { print("<", end=""); BEGIN(STR) }
+<STR>\"      { print(">", end=""); BEGIN(INITIAL) }
+<STR>[^"]+    { print("(" + yytext + ")", end="") }
+@             { yypush_buffer_state(yy_create_buffer(io.StringIO("in\"c"))) }
+[a-z]+        { print(yytext, end="") }
+<STR><<EOF>>  { print("[unterminated]", end=""); BEGIN(INITIAL) }
+<<EOF>>       {
+                  print("$", end="")
+                  yypop_buffer_state()
+                  if YY_CURRENT_BUFFER() is None:
+                      return 0
+              }
+%%
+yylex()
+`
+
+const goEOFSpec = `%option noyywrap package=main
+%{
+import (
+	"fmt"
+	"strings"
+)
+%}
+%x STR
+%%
+\"           { fmt.Print("<"); BEGIN(STR) }
+<STR>\"      { fmt.Print(">"); BEGIN(INITIAL) }
+<STR>[^"]+    { fmt.Printf("(%s)", yytext) }
+@             { yypush_buffer_state(yy_create_buffer(strings.NewReader("in\"c"), 16)) }
+[a-z]+        { fmt.Print(yytext) }
+<STR><<EOF>>  { fmt.Print("[unterminated]"); BEGIN(INITIAL) }
+<<EOF>>       {
+                  fmt.Print("$")
+                  yypop_buffer_state()
+                  if YY_CURRENT_BUFFER() == nil {
+                      return 0
+                  }
+              }
+%%
+func main() {
+	yylex()
+}
+`
+
+const cEOFSpec = `%option noyywrap
+%x STR
+%%
+\"           { printf("<"); BEGIN(STR); }
+<STR>\"      { printf(">"); BEGIN(INITIAL); }
+<STR>[^"]+    { printf("(%s)", yytext); }
+@             {
+                  FILE *f = tmpfile();
+                  fputs("in\"c", f);
+                  rewind(f);
+                  yypush_buffer_state(yy_create_buffer(f, YY_BUF_SIZE));
+              }
+[a-z]+        { printf("%s", yytext); }
+<STR><<EOF>>  { printf("[unterminated]"); BEGIN(INITIAL); }
+<<EOF>>       {
+                  printf("$");
+                  yypop_buffer_state();
+                  if (!YY_CURRENT_BUFFER) {
+                      return 0;
+                  }
+              }
+%%
+int main(void) { yylex(); return 0; }
+`
+
+func TestGenerateEOFRulesAndBuffers(t *testing.T) {
+	//@把一段新的输入压栈，每个输入结束时执行当前开始条件的<<EOF>>规则
+	input := `a"b"@d"x`
+	expected := "a<(b)>in<(c)[unterminated]$d<(x)[unterminated]$"
+
+	file, _ := generateScanner(t, pythonEOFSpec, "scanner.py")
+	require.Equal(t, expected, runScanner(t, input, "python3", file))
+
+	file, _ = generateScanner(t, goEOFSpec, "scanner.go")
+	require.Nil(t, os.WriteFile(filepath.Join(filepath.Dir(file), "go.mod"), []byte("module scanner\n\ngo 1.19\n"), 0644))
+	require.Equal(t, expected, runScanner(t, input, "go", "run", file))
+
+	file, _ = generateScanner(t, cEOFSpec, "scanner.c")
+	binary := filepath.Join(filepath.Dir(file), "scanner")
+	runScanner(t, "", "cc", "-o", binary, file)
+	require.Equal(t, expected, runScanner(t, input, binary))
+}
+
+const pythonStateStackSpec = `%option noyywrap
+%x STR
+%%
+\"            { print("<", end=""); yy_push_state(STR); }
+<STR>\"       { print(">", end=""); yy_pop_state(); }
+<STR>"${"     { print("{", end=""); yy_push_state(INITIAL); }
+\}            { print("}", end=""); yy_pop_state(); }
+<STR>[^"$]+   { print(yytext, end=""); }
+[a-z]+        { print(yytext, end=""); }
+#             { print(yy_top_state(), end=""); }
+%%
+yylex()
+`
+
+func TestGenerateStartConditionStack(t *testing.T) {
+	//字符串中的${}里面可以再嵌套字符串，每一层结束时回到外层的开始条件
+	input := `a"s${b"t${c#}"}"d`
+	expected := "a<s{b<t{c1}>}>d"
+
+	file, _ := generateScanner(t, pythonStateStackSpec, "scanner.py")
+	require.Equal(t, expected, runScanner(t, input, "python3", file))
+	_, err := runFailingScanner(t, "a}", "python3", file)
+	require.Equal(t, "start-condition stack underflow\n", err)
+
+	goSpec := strings.ReplaceAll(pythonStateStackSpec, ", end=\"\")", ")")
+	goSpec = strings.ReplaceAll(goSpec, "print(", "fmt.Print(")
+	goSpec = strings.ReplaceAll(goSpec, "%option noyywrap", "%option noyywrap package=main\n%{\nimport \"fmt\"\n%}")
+	goSpec = strings.ReplaceAll(goSpec, "yylex()", "func main() {\n\tyylex()\n}")
+	file, _ = generateScanner(t, goSpec, "scanner.go")
+	require.Nil(t, os.WriteFile(filepath.Join(filepath.Dir(file), "go.mod"), []byte("module scanner\n\ngo 1.19\n"), 0644))
+	require.Equal(t, expected, runScanner(t, input, "go", "run", file))
+
+	cSpec := strings.ReplaceAll(pythonStateStackSpec, ", end=\"\")", ")")
+	cSpec = strings.ReplaceAll(cSpec, "print(yytext", "printf(\"%s\", yytext")
+	cSpec = strings.ReplaceAll(cSpec, "print(yy_top_state", "printf(\"%d\", yy_top_state")
+	cSpec = strings.ReplaceAll(cSpec, "print(", "printf(")
+	cSpec = strings.ReplaceAll(cSpec, "yylex()", "int main(void) { yylex(); return 0; }")
+	file, _ = generateScanner(t, cSpec, "scanner.c")
+	binary := filepath.Join(filepath.Dir(file), "scanner")
+	runScanner(t, "", "cc", "-o", binary, file)
+	require.Equal(t, expected, runScanner(t, input, binary))
+	_, err = runFailingScanner(t, "a}", binary)
+	require.Equal(t, "start-condition stack underflow\n", err)
+}
+
+const goReentrantSpec = `%option noyywrap yylineno reentrant package=scanner extra-type=*[]string
+%{
+import (
+	"fmt"
+	"strings"
+)
+%}
+%x STR
+%%
+\"           { yy_push_state(STR) }
+<STR>\"      { yy_pop_state() }
+<STR>[^"]+   { *yyextra = append(*yyextra, "STR(" + yytext + ")") }
+[a-z]+       { *yyextra = append(*yyextra, yytext) }
+[0-9]+       {
+                 *yyextra = append(*yyextra, fmt.Sprintf("NUM(%s@%d)", yytext, yylineno))
+                 return 1
+             }
+[ \n]        {}
+%%
+func Tokenize(input string) []string {
+	result := make([]string, 0)
+	yyscanner := yylex_init_extra(&result)
+	yyscanner.yyset_in(strings.NewReader(input))
+	for yyscanner.yylex() != 0 {
+	}
+	return result
+}
+`
+
+const goReentrantTest = `package scanner
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentScanners(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			word := strings.Repeat("x", i%7+1)
+			input := fmt.Sprintf("%s\n%d \"s %d\"", word, i, i)
+			expected := fmt.Sprint([]string{word, fmt.Sprintf("NUM(%d@2)", i), fmt.Sprintf("STR(s %d)", i)})
+			if actual := fmt.Sprint(Tokenize(input)); actual != expected {
+				t.Errorf("got %s, want %s", actual, expected)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+`
+
+func TestGenerateReentrantGoScanner(t *testing.T) {
+	//每个goroutine使用自己的扫描器，go test -race检查生成的代码没有共享的可变状态
+	file, _ := generateScanner(t, goReentrantSpec, "scanner.go")
+	dir := filepath.Dir(file)
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module scanner\n\ngo 1.19\n"), 0644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "scanner_test.go"), []byte(goReentrantTest), 0644))
+
+	source, err := os.ReadFile(file)
+	require.Nil(t, err)
+	require.NotContains(t, string(source), "\nvar yytext")
+	runScanner(t, "", "go", "test", "-race", "-count=1", file, filepath.Join(dir, "scanner_test.go"))
+
+	for _, backend := range []Backend{BACKEND_C, BACKEND_PYTHON} {
+		options := NewLexOptions()
+		options.Backend = backend
+		options.Reentrant = true
+		err := NewCodeGenerator(options).Generate(&bytes.Buffer{}, &LexReader{}, &ScannerTables{})
+		require.EqualError(t, err, "reentrant is only supported by the go backend")
+	}
+}
+
+const goYaccSpec = `%option noyywrap goyacc package=main OPTIONS
+%{
+import "strconv"
+%}
+%%
+[0-9]+    {
+              lval.num, _ = strconv.Atoi(yytext)
+              return NUM
+          }
+\+        { return PLUS }
+[ \n]     {}
+.         { return int(yytext[0]) }
+%%
+func main() {
+	os.Exit(yyParse(LEXER))
+}
+`
+
+// goYaccParser 代替goyacc生成的语法分析器，计算 NUM (PLUS NUM)* 的和
+const goYaccParser = `package main
+
+import "fmt"
+
+type yySymType struct {
+	yys int
+	num int
+}
+
+const NUM = 57346
+const PLUS = 57347
+
+type yyLexer interface {
+	Lex(lval *yySymType) int
+	Error(s string)
+}
+
+func yyParse(yylex yyLexer) int {
+	var lval yySymType
+	sum := 0
+	for expectNum := true; ; expectNum = !expectNum {
+		switch token := yylex.Lex(&lval); {
+		case token == 0 && !expectNum:
+			fmt.Println(sum)
+			return 0
+		case token == NUM && expectNum:
+			sum += lval.num
+		case token == PLUS && !expectNum:
+		default:
+			yylex.Error("syntax error")
+			return 1
+		}
+	}
+}
+`
+
+func TestGenerateGoYaccLexer(t *testing.T) {
+	//prefix和goyacc -p一样同时改变yySymType等名称，可重入时yy_scanner本身就是yyLexer
+	for _, c := range []struct {
+		options string
+		prefix  string
+		lexer   string
+	}{
+		{"", "yy", "yy_lexer{}"},
+		{"prefix=calc", "calc", "yy_lexer{}"},
+		{"reentrant", "yy", "yylex_init()"},
+	} {
+		//%option行之后的代码使用新的前缀
+		option, body, _ := strings.Cut(strings.Replace(goYaccSpec, "LEXER", c.lexer, 1), "\n")
+		spec := strings.Replace(option, "OPTIONS", c.options, 1) + "\n" + strings.ReplaceAll(body, "yy", c.prefix)
+		file, _ := generateScanner(t, spec, "scanner.go")
+		dir := filepath.Dir(file)
+		parser := filepath.Join(dir, "parser.go")
+		require.Nil(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module scanner\n\ngo 1.19\n"), 0644))
+		require.Nil(t, os.WriteFile(parser, []byte(strings.ReplaceAll(goYaccParser, "yy", c.prefix)), 0644))
+
+		out := runScanner(t, "1 + 22\n+ 3\n", "go", "run", file, parser)
+		require.Equal(t, "26\n", out, c.options)
+		_, errOut := runFailingScanner(t, "1 +\n+ 2", "go", "run", file, parser)
+		require.Contains(t, errOut, "2:1: syntax error", c.options)
+	}
+
+	options := NewLexOptions()
+	options.GoYacc = true
+	err := NewCodeGenerator(options).Generate(&bytes.Buffer{}, &LexReader{}, &ScannerTables{})
+	require.EqualError(t, err, "goyacc is only supported by the go backend")
+}
+
+const goYaccTokenSpec = `%option noyywrap goyacc package=main
+%{
+import (
+	"fmt"
+	"strconv"
+)
+%}
+%token NUM PLUS
+%%
+[0-9]+    {
+              lval.num, _ = strconv.Atoi(yytext)
+              return NUM
+          }
+\+        => PLUS
+[ \n]     {}
+%%
+func main() {
+	fmt.Println(TokenKind(NUM), TokenKind(PLUS))
+	os.Exit(yyParse(yy_lexer{}))
+}
+`
+
+func TestGenerateGoYaccTokens(t *testing.T) {
+	//%token的名称就是goyacc生成的常量，扫描器不能再定义一次
+	file, _ := generateScanner(t, goYaccTokenSpec, "scanner.go")
+	dir := filepath.Dir(file)
+	parser := filepath.Join(dir, "parser.go")
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module scanner\n\ngo 1.19\n"), 0644))
+	require.Nil(t, os.WriteFile(parser, []byte(goYaccParser), 0644))
+
+	require.Equal(t, "NUM PLUS\n26\n", runScanner(t, "1 + 22\n+ 3\n", "go", "run", file, parser))
+}
+
+const goTokenKindSpec = `%option noyywrap package=main
+%{
+import "fmt"
+%}
+%token NUM = 1
+%token ID
+%%
+[0-9]+    => NUM
+[a-z]+    => ID
+" "       {}
+%%
+func main() {
+	for kind := yylex(); kind != 0; kind = yylex() {
+		fmt.Print(TokenKind(kind), " ")
+	}
+	fmt.Print(TokenKind(7))
+}
+`
+
+const pythonTokenKindSpec = `%option noyywrap
+%token NUM = 1
+%token ID
+%%
+[0-9]+    => NUM
+[a-z]+    => ID
+" "       {}
+%%
+while True:
+    kind = yylex()
+    if not kind:
+        break
+    print(TokenKind(kind), end=" ")
+print(yy_token_names[ID] == str(ID), end="")
+`
+
+const cTokenKindSpec = `%option noyywrap
+%token NUM = 1
+%token ID
+%%
+[0-9]+    => NUM
+[a-z]+    => ID
+" "       {}
+%%
+int main(void) {
+    int kind;
+    while ((kind = yylex()) != 0) {
+        printf("%s ", TokenKind_String((TokenKind)kind));
+    }
+    printf("%d", TokenKind_String((TokenKind)7) == NULL);
+    return 0;
+}
+`
+
+func TestGenerateTokenKinds(t *testing.T) {
+	file, _ := generateScanner(t, goTokenKindSpec, "scanner.go")
+	require.Nil(t, os.WriteFile(filepath.Join(filepath.Dir(file), "go.mod"), []byte("module scanner\n\ngo 1.19\n"), 0644))
+	out := runScanner(t, "x 12 yz", "go", "run", file)
+	require.Equal(t, "ID NUM ID TokenKind(7)", out)
+
+	file, _ = generateScanner(t, pythonTokenKindSpec, "scanner.py")
+	out = runScanner(t, "x 12 yz", "python3", file)
+	require.Equal(t, "ID NUM ID True", out)
+
+	file, _ = generateScanner(t, cTokenKindSpec, "scanner.c")
+	binary := filepath.Join(filepath.Dir(file), "scanner")
+	runScanner(t, "", "cc", "-o", binary, file)
+	out = runScanner(t, "x 12 yz", binary)
+	require.Equal(t, "ID NUM ID 1", out)
+}
+
+const pythonPrefixSpec = `%option noyywrap prefix=my
+%{
+happyy = "yy"
+%}
+%%
+[a-z]+    { print("yy:" + mytext + happyy, end="") }
+%%
+mylex()
+`
+
+func TestPrefixKeepsLiteralYY(t *testing.T) {
+	//只有扫描器的名称改用新的前缀，动作和头部代码中的yy保持不变
+	file, _ := generateScanner(t, pythonPrefixSpec, "scanner.py")
+	out := runScanner(t, "ab", "python3", file)
+	require.Equal(t, "yy:abyy", out)
+
+	source, err := os.ReadFile(file)
+	require.Nil(t, err)
+	require.Contains(t, string(source), "def mylex():")
+	require.NotContains(t, string(source), "yylex")
+	require.NotContains(t, string(source), "happmy")
+
+	options := NewLexOptions()
+	options.Prefix = "calc"
+	options.Backend = BACKEND_GO
+	require.Equal(t, `calclex(); calc_pos = "yy"; /* yylex */ happyy`, renamePrefix(options, `yylex(); yy_pos = "yy"; /* yylex */ happyy`))
+
+	//python中的//是整除运算符，后面的名称同样要替换
+	options.Backend = BACKEND_PYTHON
+	require.Equal(t, "calc_pos // calc_tab_width # yy_pos", renamePrefix(options, "yy_pos // yy_tab_width # yy_pos"))
+}
+
+func TestPythonPrefixWithTab(t *testing.T) {
+	//计算tab之后的列号时要用到改名之后的calc_tab_width
+	spec := "%option noyywrap prefix=calc\n%%\n[a-z]+    { print(calctext, end=\"\") }\n\\t    { print(\"|\", end=\"\") }\n%%\ncalclex()\n"
+	file, _ := generateScanner(t, spec, "scanner.py")
+	require.Equal(t, "ab|c", runScanner(t, "ab\tc", "python3", file))
+}
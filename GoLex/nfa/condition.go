@@ -0,0 +1,125 @@
+package nfa
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 每个规则文件都有的默认开始条件，编号为0
+const INITIAL = "INITIAL"
+
+/*
+StartCondition 对应定义部分的 %s 和 %x 声明，例如:
+%s COMMENT
+%x STRING
+规则前面的 <COMMENT,STRING> 指定规则在哪些开始条件下有效，<*> 表示所有开始条件。
+没有指定时规则在所有包含型(%s)开始条件下有效，排除型(%x)开始条件下只有明确指定的规则有效
+*/
+type StartCondition struct {
+	Name      string
+	Exclusive bool
+}
+
+func (r *Rule) ActiveIn(condition int, conditions []*StartCondition) bool {
+	//规则在编号为condition的开始条件下是否有效
+	if r.StartConditions == nil {
+		return !conditions[condition].Exclusive
+	}
+
+	for _, c := range r.StartConditions {
+		if c == condition {
+			return true
+		}
+	}
+
+	return false
+}
+
+func eofRuleFor(eofRules []*Rule, condition int) *Rule {
+	/*
+		和flex一样，明确指定了开始条件的<<EOF>>规则优先，
+		没有指定开始条件的<<EOF>>规则用于其他所有开始条件
+	*/
+	var fallback *Rule
+	for _, rule := range eofRules {
+		if rule.StartConditions == nil {
+			if fallback == nil {
+				fallback = rule
+			}
+			continue
+		}
+		for _, c := range rule.StartConditions {
+			if c == condition {
+				return rule
+			}
+		}
+	}
+
+	return fallback
+}
+
+func (l *LexReader) ConditionIndex(name string) int {
+	for i, condition := range l.StartConditions {
+		if condition.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (l *LexReader) declareConditions(line string, exclusive bool) {
+	//%s 和 %x 后面可以跟多个开始条件的名称
+	for _, name := range strings.Fields(line) {
+		if !isConditionName(name) {
+			panic(fmt.Sprintf("%s: illegal start condition :%s", l.Position(), name))
+		}
+		if l.ConditionIndex(name) != -1 || l.TokenIndex(name) != -1 {
+			panic(fmt.Sprintf("%s: start condition %s redeclared", l.Position(), name))
+		}
+		l.StartConditions = append(l.StartConditions, &StartCondition{Name: name, Exclusive: exclusive})
+	}
+}
+
+func (l *LexReader) conditionPrefix() bool {
+	/*
+		规则开头的 <SC1,SC2> 和 <<EOF>> 不属于正则表达式，分别返回START_COND和EOF_RULE，
+		不是合法的开始条件列表时 < 作为普通字符处理
+	*/
+	if strings.HasPrefix(l.currentInput, "<<EOF>>") {
+		l.currentInput = l.currentInput[len("<<EOF>>"):]
+		l.currentToken = EOF_RULE
+		l.ruleStart = false
+		return true
+	}
+
+	end := strings.IndexByte(l.currentInput, '>')
+	if l.currentInput[0] != '<' || end < 0 {
+		return false
+	}
+	names := strings.Split(l.currentInput[1:end], ",")
+	for _, name := range names {
+		if name != "*" && !isConditionName(name) {
+			return false
+		}
+	}
+
+	l.ConditionNames = names
+	l.currentInput = l.currentInput[end+1:]
+	l.currentToken = START_COND
+	return true
+}
+
+func isConditionName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for i, c := range name {
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		return false
+	}
+
+	return true
+}
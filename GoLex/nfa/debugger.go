@@ -6,14 +6,16 @@ import (
 )
 
 type Debugger struct {
-	level int
+	level   int
+	Enabled bool //是否打印语法解析的过程
 }
 
 var DEBUG *Debugger
 
 func newDebugger() *Debugger {
 	return &Debugger{
-		level: 0,
+		level:   0,
+		Enabled: true,
 	}
 }
 
@@ -26,13 +28,17 @@ func DebuggerInstance() *Debugger {
 }
 
 func (d *Debugger) Enter(name string) {
-	s := strings.Repeat("*", d.level*4) + "entering: " + name
-	fmt.Println(s)
+	if d.Enabled {
+		s := strings.Repeat("*", d.level*4) + "entering: " + name
+		fmt.Println(s)
+	}
 	d.level += 1
 }
 
 func (d *Debugger) Leave(name string) {
 	d.level -= 1
-	s := strings.Repeat("*", d.level*4) + "leaving: " + name
-	fmt.Println(s)
+	if d.Enabled {
+		s := strings.Repeat("*", d.level*4) + "leaving: " + name
+		fmt.Println(s)
+	}
 }
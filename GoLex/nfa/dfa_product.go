@@ -0,0 +1,188 @@
+package nfa
+
+/*
+交集和补集无法直接用Thompson构造法生成NFA，我们先把操作数对应的NFA片段通过MakeDTran转换成DFA，
+然后在DFA上做乘积构造(交集)或者交换接收状态(补集)，最后再把得到的DFA重新转换成NFA片段，
+这样它就能跟其他表达式一样参与连接，闭包等操作。
+和NfaDfaConverter一样，这里的DFA最多有DFA_MAX个节点，超过时返回ErrTooManyDFAStates
+*/
+type tableDFA struct {
+	trans  [][]int //trans[s][c]表示状态s接收字符c后跳转的状态，F表示没有跳转
+	accept []bool  //状态是否为接收状态
+}
+
+func subsetDFA(start *NFA) (*tableDFA, error) {
+	//借用NfaDfaConverter的子集构造算法把NFA片段转换成DFA
+	converter := NewNfaDfaConverter()
+	converter.Verbose = false
+	if err := converter.makeDTran([]*NFA{start}); err != nil {
+		return nil, err
+	}
+
+	dfa := &tableDFA{
+		trans:  make([][]int, converter.nstates),
+		accept: make([]bool, converter.nstates),
+	}
+	for i := 0; i < converter.nstates; i++ {
+		dfa.trans[i] = converter.dtrans[i]
+		dfa.accept[i] = converter.dstates[i].isAccepted
+	}
+
+	return dfa, nil
+}
+
+func complementDFA(dfa *tableDFA) (*tableDFA, error) {
+	//先增加一个死状态让跳转表变得完整，然后把接收状态和非接收状态互换
+	dead := len(dfa.trans)
+	if dead+1 > DFA_MAX {
+		return nil, ErrTooManyDFAStates
+	}
+	result := &tableDFA{
+		trans:  make([][]int, dead+1),
+		accept: make([]bool, dead+1),
+	}
+
+	for s := 0; s <= dead; s++ {
+		result.trans[s] = make([]int, MAX_CHARS)
+		for c := 0; c < MAX_CHARS; c++ {
+			if s == dead || dfa.trans[s][c] == F {
+				result.trans[s][c] = dead
+			} else {
+				result.trans[s][c] = dfa.trans[s][c]
+			}
+		}
+
+		result.accept[s] = s == dead || !dfa.accept[s]
+	}
+
+	return result, nil
+}
+
+func intersectDFA(a *tableDFA, b *tableDFA) (*tableDFA, error) {
+	//乘积构造，新状态对应(a的状态, b的状态)，只有两者都是接收状态时新状态才是接收状态
+	pairs := map[[2]int]int{{0, 0}: 0}
+	queue := [][2]int{{0, 0}}
+	result := &tableDFA{}
+
+	for len(queue) > 0 {
+		pair := queue[0]
+		queue = queue[1:]
+		row := make([]int, MAX_CHARS)
+		for c := 0; c < MAX_CHARS; c++ {
+			nextA := a.trans[pair[0]][c]
+			nextB := b.trans[pair[1]][c]
+			if nextA == F || nextB == F {
+				row[c] = F
+				continue
+			}
+
+			next := [2]int{nextA, nextB}
+			state, ok := pairs[next]
+			if !ok {
+				if len(pairs) >= DFA_MAX {
+					return nil, ErrTooManyDFAStates
+				}
+				state = len(pairs)
+				pairs[next] = state
+				queue = append(queue, next)
+			}
+			row[c] = state
+		}
+
+		result.trans = append(result.trans, row)
+		result.accept = append(result.accept, a.accept[pair[0]] && b.accept[pair[1]])
+	}
+
+	return result, nil
+}
+
+func (d *tableDFA) liveStates() []bool {
+	//找出所有能够到达接收状态的节点，其他节点都是死状态，转换成NFA时可以丢弃
+	live := make([]bool, len(d.trans))
+	copy(live, d.accept)
+	for changed := true; changed; {
+		changed = false
+		for s := range d.trans {
+			if live[s] {
+				continue
+			}
+			for c := 0; c < MAX_CHARS; c++ {
+				if d.trans[s][c] != F && live[d.trans[s][c]] {
+					live[s] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	return live
+}
+
+func (d *tableDFA) toNFA() (start *NFA, end *NFA) {
+	/*
+		每个DFA状态对应一个NFA入口节点，跳转到同一个状态的所有字符合并成一条字符集边，
+		一个NFA节点最多只有两条边，因此入口节点通过一串epsilon节点分叉到每条字符集边，
+		接收状态额外用一条epsilon边连接到片段的结束节点
+	*/
+	end = NewNFA()
+	live := d.liveStates()
+	if !live[0] {
+		//表达式不匹配任何字符串，用一条空字符集边连接头尾
+		start = NewNFA()
+		start.edge = CCL
+		start.next = end
+		return start, end
+	}
+
+	entries := make([]*NFA, len(d.trans))
+	for s := range d.trans {
+		if live[s] {
+			entries[s] = NewNFA()
+		}
+	}
+
+	for s := range d.trans {
+		if !live[s] {
+			continue
+		}
+
+		successors := make([]*NFA, 0)
+		edges := make(map[int]*NFA)
+		for c := 0; c < MAX_CHARS; c++ {
+			target := d.trans[s][c]
+			if target == F || !live[target] {
+				continue
+			}
+
+			edge, ok := edges[target]
+			if !ok {
+				edge = NewNFA()
+				edge.edge = CCL
+				edge.next = entries[target]
+				edges[target] = edge
+				successors = append(successors, edge)
+			}
+			edge.bitset[string(rune(c))] = true
+		}
+
+		if d.accept[s] {
+			successors = append(successors, end)
+		}
+
+		fork := entries[s]
+		fork.next = successors[0]
+		for i := 1; i < len(successors); i++ {
+			if i == len(successors)-1 {
+				fork.next2 = successors[i]
+			} else {
+				node := NewNFA()
+				fork.next2 = node
+				node.next = successors[i]
+				fork = node
+			}
+		}
+	}
+
+	return entries[0], end
+}
@@ -0,0 +1,340 @@
+package nfa
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+/*
+ShadowedRule 记录一条永远不会被匹配的规则，例如:
+[a-z]+  {return ID}
+if      {return IF}
+所有能被if匹配的字符串也能被[a-z]+匹配，并且[a-z]+排在前面，因此第二条规则永远不会执行
+*/
+type ShadowedRule struct {
+	Rule          int    //不会被匹配的规则
+	Pattern       string //该规则的正则表达式
+	Position      string //该规则在输入文件中的位置
+	Winner        int    //抢先匹配的规则，-1表示该规则不能匹配任何字符串
+	WinnerPattern string
+	Witness       string //两条规则都能匹配的最短字符串
+}
+
+func (s *ShadowedRule) String() string {
+	if s.Winner == -1 {
+		return fmt.Sprintf("rule %d %s can never match: it matches no input", s.Rule, s.Pattern)
+	}
+
+	return fmt.Sprintf("rule %d %s is shadowed by rule %d %s, e.g. %q matches rule %d",
+		s.Rule, s.Pattern, s.Winner, s.WinnerPattern, s.Witness, s.Winner)
+}
+
+func (n *NfaDfaConverter) shortestPaths() ([]int, []int) {
+	/*
+		从所有起始状态开始广度优先遍历DFA，记录到达每个状态的最短路径上的前一个状态和输入字符，
+		起始状态的前一个状态是它自己，没有访问到的状态前一个状态为F
+	*/
+	parent := make([]int, n.nstates)
+	input := make([]int, n.nstates)
+	for i := range parent {
+		parent[i] = F
+	}
+
+	order := []int{0}
+	parent[0] = 0
+	for _, start := range append(append([]int{n.bolStart}, n.starts...), n.bolStarts...) {
+		//每个开始条件都有自己的起始状态
+		if parent[start] == F {
+			order = append(order, start)
+			parent[start] = start
+		}
+	}
+	for i := 0; i < len(order); i++ {
+		state := order[i]
+		for c := 0; c < MAX_CHARS; c++ {
+			next := n.dtrans[state][c]
+			if next == F || parent[next] != F {
+				continue
+			}
+			parent[next] = state
+			input[next] = c
+			order = append(order, next)
+		}
+	}
+
+	return parent, input
+}
+
+func (n *NfaDfaConverter) pathTo(state int, parent []int, input []int) string {
+	path := make([]byte, 0)
+	for parent[state] != state {
+		path = append([]byte{byte(input[state])}, path...)
+		state = parent[state]
+	}
+
+	return string(path)
+}
+
+func (n *NfaDfaConverter) ShadowedRules(rules []*Rule) []*ShadowedRule {
+	/*
+		在MakeDTran之后，MinimizeDFA之前调用。每个接收状态在行尾时对应最前面的一条规则，
+		不在行尾时对应最前面的不带$的规则，使用REJECT时还可以依次轮到排在后面的规则，
+		如果一条规则不对应任何接收状态，那么它永远不会被匹配。
+		为了说明原因，我们找到最短的一个字符串，它使得DFA进入的状态包含该规则的接收节点，
+		这个状态对应的规则就是抢先匹配的规则
+	*/
+	labelled := make([]bool, len(rules))
+	for i := 0; i < n.nstates; i++ {
+		if !n.dstates[i].isAccepted {
+			continue
+		}
+		labelled[n.dstates[i].rule] = true
+		if n.dstates[i].hasPlain {
+			labelled[n.dstates[i].plainRule] = true
+		}
+		for _, r := range n.dstates[i].accepts {
+			//前面的规则执行REJECT后轮到下一条规则，直到某条规则不使用REJECT
+			labelled[r] = true
+			if !rejectPattern.MatchString(rules[r].Action) {
+				break
+			}
+		}
+	}
+
+	parent, input := n.shortestPaths()
+	depth := make([]int, n.nstates)
+	for i := 0; i < n.nstates; i++ {
+		depth[i] = len(n.pathTo(i, parent, input))
+	}
+
+	shadowed := make([]*ShadowedRule, 0)
+	for r, rule := range rules {
+		if labelled[r] {
+			continue
+		}
+
+		report := &ShadowedRule{
+			Rule:     r,
+			Pattern:  rule.Regex.String(),
+			Position: rule.Position,
+			Winner:   -1,
+		}
+		witness := F
+		for i := 0; i < n.nstates; i++ {
+			if parent[i] == F || !n.containsAccept(i, r) {
+				continue
+			}
+			if witness == F || depth[i] < depth[witness] {
+				witness = i
+			}
+		}
+
+		if witness != F {
+			report.Winner = n.dstates[witness].rule
+			report.WinnerPattern = rules[report.Winner].Regex.String()
+			report.Witness = n.pathTo(witness, parent, input)
+		}
+		shadowed = append(shadowed, report)
+	}
+
+	return shadowed
+}
+
+func (n *NfaDfaConverter) containsAccept(state int, rule int) bool {
+	//DFA状态对应的NFA集合中是否包含指定规则的接收节点
+	for _, node := range n.dstates[state].set {
+		if node.next == nil && node.rule == rule {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+RuleOverlap 记录两条能匹配同一个字符串的规则，例如 if 和 [a-z]+ 都能匹配"if"，
+此时排在前面的规则胜出
+*/
+type RuleOverlap struct {
+	First   int    //排在前面的规则，两者都能匹配时它胜出
+	Second  int    //排在后面的规则
+	Witness string //两条规则都能匹配的最短字符串
+}
+
+func (n *NfaDfaConverter) RuleOverlaps(rules []*Rule) []*RuleOverlap {
+	/*
+		在MakeDTran之后，MinimizeDFA之前调用。每个DFA状态记录了所有能在该状态匹配的规则，
+		两条规则同时出现在一个状态中说明它们能匹配同一个字符串，
+		到达该状态的最短路径就是两者都能匹配的最短字符串
+	*/
+	parent, input := n.shortestPaths()
+	witnesses := make(map[[2]int]string)
+	for i := 0; i < n.nstates; i++ {
+		if parent[i] == F {
+			continue
+		}
+
+		path := n.pathTo(i, parent, input)
+		accepts := n.dstates[i].accepts
+		for a := 0; a < len(accepts); a++ {
+			for b := a + 1; b < len(accepts); b++ {
+				pair := [2]int{accepts[a], accepts[b]}
+				if witness, ok := witnesses[pair]; !ok || len(path) < len(witness) {
+					witnesses[pair] = path
+				}
+			}
+		}
+	}
+
+	overlaps := make([]*RuleOverlap, 0)
+	for first := range rules {
+		for second := first + 1; second < len(rules); second++ {
+			if witness, ok := witnesses[[2]int{first, second}]; ok {
+				overlaps = append(overlaps, &RuleOverlap{First: first, Second: second, Witness: witness})
+			}
+		}
+	}
+
+	return overlaps
+}
+
+func (n *NfaDfaConverter) Lint(w io.Writer, rules []*Rule) bool {
+	/*
+		输出所有规则，规则之间的重叠矩阵以及永远不会被匹配的规则，矩阵第i行第j列是规则i和规则j
+		都能匹配的最短字符串，编号小的规则胜出。没有永远不会被匹配的规则时返回true
+	*/
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "rules:")
+	for i, rule := range rules {
+		fmt.Fprintf(tw, "  %d\t%s\t%s\n", i, rule.Position, rule.Regex.String())
+	}
+	tw.Flush()
+
+	matrix := make([][]string, len(rules))
+	for i := range matrix {
+		matrix[i] = make([]string, len(rules))
+		for j := range matrix[i] {
+			matrix[i][j] = "."
+		}
+	}
+	for _, overlap := range n.RuleOverlaps(rules) {
+		witness := fmt.Sprintf("%q", overlap.Witness)
+		matrix[overlap.First][overlap.Second] = witness
+		matrix[overlap.Second][overlap.First] = witness
+	}
+
+	fmt.Fprintln(w, "\noverlaps (the lower numbered rule wins):")
+	fmt.Fprint(tw, " ")
+	for i := range rules {
+		fmt.Fprintf(tw, "\t%d", i)
+	}
+	fmt.Fprintln(tw)
+	for i, row := range matrix {
+		fmt.Fprintf(tw, "  %d", i)
+		for _, cell := range row {
+			fmt.Fprintf(tw, "\t%s", cell)
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+
+	backingUp := n.BackingUpStates()
+	if len(backingUp) > 0 {
+		fmt.Fprintln(w, "\nbacking up:")
+		n.WriteBackingUp(w, rules, backingUp)
+	}
+
+	shadowed := n.ShadowedRules(rules)
+	if len(shadowed) > 0 {
+		fmt.Fprintln(w, "\nshadowed:")
+		for _, rule := range shadowed {
+			fmt.Fprintf(w, "  %s: %s\n", rule.Position, rule)
+		}
+	}
+
+	return len(shadowed) == 0
+}
+
+/*
+BackingUpState 记录一个可能需要回退的非接收状态。例如规则 foo 和 foobar，
+读入fooba后进入的状态不是接收状态，如果下一个字符不是r，那么扫描器要回退到读入foo时的接收状态
+*/
+type BackingUpState struct {
+	State int             //DFA状态编号
+	Input string          //进入该状态的最短输入
+	Rules []int           //从该状态出发还能匹配的规则
+	Jams  map[string]bool //在该状态没有跳转的字符
+}
+
+func (n *NfaDfaConverter) BackingUpStates() []*BackingUpState {
+	/*
+		非接收状态如果对某些字符没有跳转，那么扫描器在这里失败时必须回退到上一次进入接收状态的位置，
+		起始状态除外，因为那时还没有读入任何字符。MakeDTran或MinimizeDFA之后都可以调用
+	*/
+	parent, input := n.shortestPaths()
+	backingUp := make([]*BackingUpState, 0)
+	for i := 1; i < n.nstates; i++ {
+		if parent[i] == F || parent[i] == i || n.dstates[i].isAccepted {
+			continue
+		}
+
+		jams := make(map[string]bool)
+		for c := 0; c < MAX_CHARS; c++ {
+			if n.dtrans[i][c] == F {
+				jams[string(rune(c))] = true
+			}
+		}
+		if len(jams) == 0 {
+			continue
+		}
+
+		backingUp = append(backingUp, &BackingUpState{
+			State: i,
+			Input: n.pathTo(i, parent, input),
+			Rules: n.reachableRules(i),
+			Jams:  jams,
+		})
+	}
+
+	return backingUp
+}
+
+func (n *NfaDfaConverter) reachableRules(state int) []int {
+	//从state出发能到达的所有接收状态对应的规则
+	visited := make([]bool, n.nstates)
+	visited[state] = true
+	stack := []int{state}
+	rules := make([]int, 0)
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[0 : len(stack)-1]
+		for _, rule := range n.dstates[current].accepts {
+			rules = insertRule(rules, rule)
+		}
+		for c := 0; c < MAX_CHARS; c++ {
+			next := n.dtrans[current][c]
+			if next != F && !visited[next] {
+				visited[next] = true
+				stack = append(stack, next)
+			}
+		}
+	}
+
+	return rules
+}
+
+func (n *NfaDfaConverter) WriteBackingUp(w io.Writer, rules []*Rule, states []*BackingUpState) {
+	//按照flex -b的格式输出需要回退的状态
+	for _, state := range states {
+		fmt.Fprintf(w, "State #%d is non-accepting -\n", state.State)
+		fmt.Fprintf(w, " input %q leads here\n", state.Input)
+		fmt.Fprintln(w, " associated rules:")
+		for _, rule := range state.Rules {
+			fmt.Fprintf(w, "  %d %s %s\n", rule, rules[rule].Position, rules[rule].Regex)
+		}
+		fmt.Fprintf(w, " jam-transitions: %s\n\n", (&CharClassNode{Set: state.Jams}).String())
+	}
+
+	fmt.Fprintf(w, "%d non-accepting states may back up\n", len(states))
+}
@@ -0,0 +1,118 @@
+package nfa
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func makeTestDFA(t *testing.T, spec string) (*NfaDfaConverter, []*Rule) {
+	rules := parseRules(t, spec)
+	converter := NewNfaDfaConverter()
+	converter.Verbose = false
+	converter.MakeDTran(NewAstNfaConverter().MakeNFA(rules))
+	return converter, rules
+}
+
+func TestShadowedRules(t *testing.T) {
+	converter, rules := makeTestDFA(t, "%%\n[a-z]+   {return ID}\nif   {return IF}\n[0-9]+   {return NUM}\n%%\n")
+	shadowed := converter.ShadowedRules(rules)
+	require.Equal(t, 1, len(shadowed))
+	require.Equal(t, 1, shadowed[0].Rule)
+	require.Equal(t, 0, shadowed[0].Winner)
+	require.Equal(t, "if", shadowed[0].Witness)
+	require.Contains(t, shadowed[0].Position, "input.lex:3")
+	require.Equal(t, `rule 1 if is shadowed by rule 0 [a-z]+, e.g. "if" matches rule 0`, shadowed[0].String())
+}
+
+func TestPartiallyShadowedRule(t *testing.T) {
+	//if排在前面时两条规则都有机会匹配
+	converter, rules := makeTestDFA(t, "%%\nif   {return IF}\n[a-z]+   {return ID}\n%%\n")
+	require.Equal(t, 0, len(converter.ShadowedRules(rules)))
+
+	//a+ 只能被更前面的规则组合覆盖，最短的例子是a
+	converter, rules = makeTestDFA(t, "%%\na   {}\naa+   {}\na+   {}\n%%\n")
+	shadowed := converter.ShadowedRules(rules)
+	require.Equal(t, 1, len(shadowed))
+	require.Equal(t, 2, shadowed[0].Rule)
+	require.Equal(t, "a", shadowed[0].Witness)
+	require.Equal(t, 0, shadowed[0].Winner)
+}
+
+func TestRuleMatchingNothing(t *testing.T) {
+	converter, rules := makeTestDFA(t, "%%\na   {}\n[a-c]&[x-z]   {}\n%%\n")
+	shadowed := converter.ShadowedRules(rules)
+	require.Equal(t, 1, len(shadowed))
+	require.Equal(t, -1, shadowed[0].Winner)
+	require.Contains(t, shadowed[0].String(), "matches no input")
+}
+
+func TestRuleOverlaps(t *testing.T) {
+	converter, rules := makeTestDFA(t, "%%\nif   {}\n[a-z]+   {}\n[a-f0-9]+   {}\n[0-9]+   {}\n%%\n")
+	overlaps := converter.RuleOverlaps(rules)
+	require.Equal(t, []*RuleOverlap{
+		{First: 0, Second: 1, Witness: "if"},
+		{First: 1, Second: 2, Witness: "a"},
+		{First: 2, Second: 3, Witness: "0"},
+	}, overlaps)
+}
+
+func TestLintReport(t *testing.T) {
+	converter, rules := makeTestDFA(t, "%%\n[a-z]+   {}\nif   {}\n%%\n")
+	var report strings.Builder
+	require.False(t, converter.Lint(&report, rules))
+	require.Contains(t, report.String(), "overlaps (the lower numbered rule wins):")
+	require.Contains(t, report.String(), `  1  "if"  .`)
+	require.Contains(t, report.String(), "rule 1 if is shadowed by rule 0 [a-z]+")
+
+	converter, rules = makeTestDFA(t, "%%\nif   {}\n[a-z]+   {}\n%%\n")
+	require.True(t, converter.Lint(&report, rules))
+}
+
+func TestBackingUpStates(t *testing.T) {
+	converter, rules := makeTestDFA(t, "%%\nfoo   {}\nfoobar   {}\n%%\n")
+	converter.MinimizeDFA()
+	states := converter.BackingUpStates()
+	inputs := make([]string, 0)
+	for _, state := range states {
+		inputs = append(inputs, state.Input)
+	}
+	//读入f,fo时失败不需要回退到接收状态，但是也要重新读取已经读入的字符
+	require.Equal(t, []string{"f", "fo", "foob", "fooba"}, inputs)
+	require.Equal(t, []int{1}, states[3].Rules)
+	require.Equal(t, []int{0, 1}, states[0].Rules)
+
+	var report strings.Builder
+	converter.WriteBackingUp(&report, rules, states[3:])
+	require.Contains(t, report.String(), " input \"fooba\" leads here\n")
+	require.Contains(t, report.String(), "  1 ")
+	require.Contains(t, report.String(), ` jam-transitions: [\^@-qs-\x07f]`)
+	require.Contains(t, report.String(), "1 non-accepting states may back up\n")
+
+	converter, _ = makeTestDFA(t, "%%\n[a-z]+   {}\n%%\n")
+	require.Equal(t, 0, len(converter.BackingUpStates()))
+}
+
+func TestAnchoredRuleIsReachable(t *testing.T) {
+	converter, rules := makeTestDFA(t, "%%\n^if   {}\n[a-z]+   {}\nif   {}\n%%\n")
+	shadowed := converter.ShadowedRules(rules)
+	require.Equal(t, 1, len(shadowed))
+	require.Equal(t, 2, shadowed[0].Rule)
+	require.Equal(t, 1, shadowed[0].Winner)
+}
+
+func TestEOLRuleDoesNotShadowPlainRule(t *testing.T) {
+	//[a-z]+$只在行尾接收，其他位置的单词由排在后面的[a-z]+匹配
+	converter, rules := makeTestDFA(t, "%%\n[a-z]+$   {}\n[a-z]+   {}\n[ \\n]   {}\n%%\n")
+	require.Equal(t, 0, len(converter.ShadowedRules(rules)))
+
+	//第一条规则执行REJECT之后轮到第二条规则，第二条规则不使用REJECT，因此轮不到第三条规则
+	converter, rules = makeTestDFA(t, "%%\n[a-z]+   { REJECT; }\n[a-z]+   {}\nif   {}\n%%\n")
+	shadowed := converter.ShadowedRules(rules)
+	require.Equal(t, 1, len(shadowed))
+	require.Equal(t, 2, shadowed[0].Rule)
+
+	converter, rules = makeTestDFA(t, "%%\n[a-z]+   { REJECT; }\nif   {}\n%%\n")
+	require.Equal(t, 0, len(converter.ShadowedRules(rules)))
+}
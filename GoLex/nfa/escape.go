@@ -0,0 +1,129 @@
+package nfa
+
+import (
+	"strings"
+	"unicode"
+)
+
+func (l *LexReader) esc() int {
+	/*
+			该函数将转义符转换成对应ASCII码并返回，如果currentInput对应的第一个字符不是反斜杠，那么它直接返回第一个字符
+		    然后currentInput递进一个字符。下列转义符将会被处理
+		   \b  backspace
+		   \f  formfeed
+		   \n  newline
+		   \r  carriage return
+		   \t  tab
+		   \s  空格
+		   \e  ESC字符 对应('\033')
+		   \^C C是任何字母，它表示控制符
+		   \xhhh 最多三位十六进制数字，后面不是十六进制数字时表示字符x本身
+		   \ooo 最多三位八进制数字
+		   其他字符前面的反斜杠被忽略，出现在末尾的反斜杠表示反斜杠本身
+	*/
+	var rval int
+	if l.currentInput[0] != '\\' {
+		rval = int(l.currentInput[0])
+		l.currentInput = l.currentInput[1:]
+	} else if len(l.currentInput) == 1 {
+		//反斜杠出现在末尾，那么它就表示反斜杠本身
+		rval = '\\'
+		l.currentInput = l.currentInput[1:]
+	} else {
+		l.currentInput = l.currentInput[1:] //越过反斜杠
+		currentInputUpcase := strings.ToUpper(l.currentInput)
+		switch currentInputUpcase[0] {
+		case 'B':
+			rval = '\b'
+			l.currentInput = l.currentInput[1:]
+		case 'F':
+			rval = '\f'
+			l.currentInput = l.currentInput[1:]
+		case 'N':
+			rval = '\n'
+			l.currentInput = l.currentInput[1:]
+		case 'R':
+			rval = '\r'
+			l.currentInput = l.currentInput[1:]
+		case 'S':
+			rval = ' '
+			l.currentInput = l.currentInput[1:]
+		case 'T':
+			rval = '\t'
+			l.currentInput = l.currentInput[1:]
+		case 'E':
+			rval = '\033'
+			l.currentInput = l.currentInput[1:]
+		case '^':
+			l.currentInput = l.currentInput[1:]
+			if len(l.currentInput) == 0 {
+				rval = '^'
+				break
+			}
+			upperStr := strings.ToUpper(l.currentInput)
+			rval = int(upperStr[0] - '@')
+			l.currentInput = l.currentInput[1:]
+		case 'X':
+			rval = 0
+			x := l.currentInput[0]
+			l.currentInput = l.currentInput[1:]
+			digits := 0
+			for digits < 3 && len(l.currentInput) > 0 && l.isHexDigit(l.currentInput[0]) {
+				rval <<= 4
+				rval |= int(l.hex2bin(l.currentInput[0]))
+				l.currentInput = l.currentInput[1:]
+				digits += 1
+			}
+			if digits == 0 {
+				//如果接在X后面的不是合法16进制字符，那么我们仅仅忽略掉反斜杠即可
+				rval = int(x)
+			}
+		default:
+			if !l.isOctDigit(l.currentInput[0]) {
+				rval = int(l.currentInput[0])
+				l.currentInput = l.currentInput[1:]
+			} else {
+				//最多读取三个八进制数字
+				rval = 0
+				digits := 0
+				for digits < 3 && len(l.currentInput) > 0 && l.isOctDigit(l.currentInput[0]) {
+					rval <<= 3
+					rval |= int(l.oct2bin(l.currentInput[0]))
+					l.currentInput = l.currentInput[1:]
+					digits += 1
+				}
+			}
+		}
+	}
+
+	return rval
+}
+
+func (l *LexReader) isHexDigit(x uint8) bool {
+	return unicode.IsDigit(rune(x)) || ('a' <= x && x <= 'f') || ('A' <= x && x <= 'F')
+}
+
+func (l *LexReader) isOctDigit(x uint8) bool {
+	return '0' <= x && x <= '7'
+}
+
+func (l *LexReader) hex2bin(x uint8) uint8 {
+	/*
+		将16进制字符转换为对应数值, x 必须必须是如下字符0123456789abcdefABCDEF
+	*/
+	var val uint8
+	if unicode.IsDigit(rune(x)) {
+		val = x - '0'
+	} else {
+		val = uint8(unicode.ToUpper(rune(x))-'A'+10) & 0xf
+	}
+
+	return val
+}
+
+func (l *LexReader) oct2bin(x uint8) uint8 {
+	/*
+		将十六进制的数字或字母转换为八进制数字，输入的x必须在范围'0'-'7'
+	*/
+	return (x - '0') & 0x7
+}
@@ -0,0 +1,51 @@
+package nfa
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscapes(t *testing.T) {
+	//十六进制最多三位，字母不区分大小写，八进制最多三位，\^X是控制字符，\后面不是合法数字时表示字符本身
+	start := parseSpec(t, "%%\n\\x41\\x6a\\101\\7\\^Ab\\xq\\. return 1\n")
+	require.True(t, NfaMatchString(start, "Aj\x41\x07\x01bxq."))
+	require.False(t, NfaMatchString(start, "Aj\x41\x07Abxq."))
+
+	start = parseSpec(t, "%%\n[\\x30-\\x39]\\0141 return 1\n")
+	require.True(t, NfaMatchString(start, "5\x0c1"))
+	require.False(t, NfaMatchString(start, "5a"))
+}
+
+func TestEscapeValues(t *testing.T) {
+	//每个输入经过esc之后的值，以及剩下没有读入的字符
+	cases := []struct {
+		input string
+		value int
+		rest  string
+	}{
+		{"\\b", '\b', ""},
+		{"\\F", '\f', ""},
+		{"\\nx", '\n', "x"},
+		{"\\r", '\r', ""},
+		{"\\t", '\t', ""},
+		{"\\s", ' ', ""},
+		{"\\e", 033, ""},
+		{"\\^a1", 1, "1"},
+		{"\\^", '^', ""},
+		{"\\x4a", 'J', ""},
+		{"\\x7E", '~', ""},
+		{"\\x0411", 0x41, "1"},
+		{"\\xg", 'x', "g"},
+		{"\\1011", 'A', "1"},
+		{"\\08", 0, "8"},
+		{"\\9", '9', ""},
+		{"\\", '\\', ""},
+		{"a\\", 'a', "\\"},
+	}
+	for _, c := range cases {
+		l := &LexReader{currentInput: c.input}
+		require.Equal(t, c.value, l.esc(), c.input)
+		require.Equal(t, c.rest, l.currentInput, c.input)
+	}
+}
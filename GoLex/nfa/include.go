@@ -0,0 +1,106 @@
+package nfa
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//go:embed std/*.lexdefs
+var stdLibrary embed.FS
+
+type includeFile struct {
+	name    string         //诊断信息中显示的文件名
+	key     string         //用于检查是否循环包含
+	scanner *bufio.Scanner //按行读取文件内容
+	closer  io.Closer      //读取完毕后需要关闭的文件
+	lineNo  int            //被其他文件打断时读到的行号
+}
+
+func (l *LexReader) Position() string {
+	//当前读取位置，格式为 文件名:行号
+	return fmt.Sprintf("%s:%d", l.input.name, l.ActualLineNo)
+}
+
+func (l *LexReader) include(arg string) {
+	/*
+		处理定义部分的 %include 指令，有两种形式:
+		%include "common.lexdefs"  相对于当前文件所在的目录查找
+		%include <std/numbers>     使用内置的宏定义库
+		被包含文件的内容读取完后回到原来的文件继续读取
+	*/
+	arg = strings.TrimSpace(arg)
+	if len(arg) < 2 {
+		panic(fmt.Sprintf("%s: missing file name in %%include", l.Position()))
+	}
+
+	var input *includeFile
+	switch {
+	case arg[0] == '"' && arg[len(arg)-1] == '"':
+		name := arg[1 : len(arg)-1]
+		if !filepath.IsAbs(name) && !strings.HasPrefix(l.input.key, "<") {
+			name = filepath.Join(filepath.Dir(l.input.name), name)
+		}
+		key, err := filepath.Abs(name)
+		if err != nil {
+			key = name
+		}
+		l.checkIncludeCycle(key)
+		file, err := os.Open(name)
+		if err != nil {
+			panic(fmt.Sprintf("%s: %s", l.Position(), err.Error()))
+		}
+		input = &includeFile{name: name, key: key, scanner: bufio.NewScanner(file), closer: file}
+	case arg[0] == '<' && arg[len(arg)-1] == '>':
+		name := arg[1 : len(arg)-1]
+		l.checkIncludeCycle(arg)
+		file, err := stdLibrary.Open(name + ".lexdefs")
+		if err != nil {
+			panic(fmt.Sprintf("%s: no library %s", l.Position(), arg))
+		}
+		input = &includeFile{name: arg, key: arg, scanner: bufio.NewScanner(file), closer: file}
+	default:
+		panic(fmt.Sprintf("%s: illegal %%include %s", l.Position(), arg))
+	}
+
+	l.input.lineNo = l.ActualLineNo
+	l.includeStack = append(l.includeStack, l.input)
+	l.input = input
+	l.ActualLineNo = 0
+}
+
+func (l *LexReader) checkIncludeCycle(key string) {
+	//如果要包含的文件已经在包含路径上，那么报告整条路径，例如 a.lexdefs -> b.lexdefs -> a.lexdefs
+	inputs := append(append([]*includeFile{}, l.includeStack...), l.input)
+	for i, input := range inputs {
+		if input.key != key {
+			continue
+		}
+
+		chain := make([]string, 0)
+		for _, included := range inputs[i:] {
+			chain = append(chain, included.name)
+		}
+		chain = append(chain, input.name)
+		panic(fmt.Sprintf("%s: include cycle: %s", l.Position(), strings.Join(chain, " -> ")))
+	}
+}
+
+func (l *LexReader) popInclude() bool {
+	//当前文件读取完毕，回到包含它的文件，如果已经是最外层的文件就返回false
+	if len(l.includeStack) == 0 {
+		return false
+	}
+
+	if l.input.closer != nil {
+		l.input.closer.Close()
+	}
+	l.input = l.includeStack[len(l.includeStack)-1]
+	l.includeStack = l.includeStack[0 : len(l.includeStack)-1]
+	l.ActualLineNo = l.input.lineNo
+	return true
+}
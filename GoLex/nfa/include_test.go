@@ -0,0 +1,77 @@
+package nfa
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSpecFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		require.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	return dir
+}
+
+func readHead(t *testing.T, input string) *LexReader {
+	lexReader, err := NewLexReader(input, filepath.Join(filepath.Dir(input), "output.py"))
+	require.Nil(t, err)
+	lexReader.Verbose = false
+	lexReader.Head()
+	return lexReader
+}
+
+func TestIncludeFile(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"common.lexdefs": "INCA  [a-c]\n%option caseless\n",
+		"input.lex":      "%include \"common.lexdefs\"\nINCB  {INCA}x\n%%\n{INCB}   {}\n%%\n",
+	})
+	lexReader := readHead(t, filepath.Join(dir, "input.lex"))
+	require.True(t, lexReader.Options.Caseless)
+	require.Equal(t, filepath.Join(dir, "input.lex")+":3", lexReader.Position())
+
+	parser, _ := NewRegParser(lexReader)
+	rules := parser.ParseAST()
+	require.Equal(t, 1, len(rules))
+	require.True(t, acceptsString(NewAstNfaConverter().MakeNFA(rules), "BX"))
+}
+
+func TestIncludeStdLibrary(t *testing.T) {
+	rules := parseRules(t, "%include <std/numbers>\n%include <std/strings>\n%%\n{FLOAT}   {}\n{DQSTRING}   {}\n%%\n")
+	require.Equal(t, 2, len(rules))
+	float := NewAstNfaConverter().MakeNFA(rules[0:1])
+	require.True(t, acceptsString(float, "3.14e-2"))
+	require.True(t, acceptsString(float, "1e9"))
+	require.False(t, acceptsString(float, "12"))
+	require.True(t, acceptsString(NewAstNfaConverter().MakeNFA(rules[1:2]), `"a\"b"`))
+}
+
+func TestIncludeCycle(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"a.lexdefs": "%include \"b.lexdefs\"\n",
+		"b.lexdefs": "INCC  c\n%include \"a.lexdefs\"\n",
+		"input.lex": "%include \"a.lexdefs\"\n%%\n",
+	})
+	a := filepath.Join(dir, "a.lexdefs")
+	b := filepath.Join(dir, "b.lexdefs")
+	assert.PanicsWithValue(t, b+":2: include cycle: "+a+" -> "+b+" -> "+a, func() {
+		readHead(t, filepath.Join(dir, "input.lex"))
+	})
+}
+
+func TestIncludeDiagnostics(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"bad.lexdefs": "INCD  d\n\n%option nosuchoption\n",
+		"input.lex":   "%include \"bad.lexdefs\"\n%%\n",
+	})
+	bad := filepath.Join(dir, "bad.lexdefs")
+	assert.PanicsWithValue(t, bad+":3: illegal option :nosuchoption", func() {
+		readHead(t, filepath.Join(dir, "input.lex"))
+	})
+	assert.Panics(t, func() { parseRules(t, "%include <std/nosuchlib>\n%%\n") })
+}
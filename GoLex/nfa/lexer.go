@@ -0,0 +1,495 @@
+package nfa
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// 没有规则能够匹配时，Token.Rule的值
+const UNMATCHED = -1
+
+// 输入结束时执行<<EOF>>规则，Token.Rule的值
+const END_OF_FILE = -2
+
+/*
+Lexer 是编译好的词法规则，它直接使用最小化后的DFA跳转表扫描输入，不需要生成代码，例如:
+
+	lexer, err := nfa.CompileSpec(strings.NewReader(spec))
+	scanner := lexer.Scan(os.Stdin)
+	for {
+		token, err := scanner.Next()
+		if err == io.EOF {
+			break
+		}
+		...
+	}
+*/
+type Lexer struct {
+	Rules   []*Rule     //规则部分的所有规则，Token.Rule是这里的下标
+	Options *LexOptions //定义部分的 %option 设置
+	//定义部分声明的开始条件，INITIAL总是第一个
+	Conditions []*StartCondition
+	EOFRules   []*Rule //<<EOF>>规则，见Scanner.Next
+	tables     *ScannerTables
+}
+
+type Position struct {
+	Offset int //从0开始的字节偏移
+	Line   int //从1开始的行号
+	Column int //从1开始的列号，tab按照 %option tabwidth= 设置的宽度对齐
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+func (p Position) advance(lexeme []byte, tabWidth int) Position {
+	//返回读过lexeme之后的位置
+	for _, c := range lexeme {
+		switch c {
+		case '\n':
+			p.Line += 1
+			p.Column = 1
+		case '\t':
+			p.Column = ((p.Column-1)/tabWidth+1)*tabWidth + 1
+		default:
+			p.Column += 1
+		}
+	}
+	p.Offset += len(lexeme)
+
+	return p
+}
+
+type Token struct {
+	Rule   int    //匹配的规则编号，UNMATCHED表示没有规则能够匹配，此时Lexeme只有一个字符，END_OF_FILE表示<<EOF>>规则
+	Name   string //匹配的规则的名称
+	Lexeme []byte //匹配的字符串
+	Start  Position
+	End    Position //token最后一个字符之后的位置
+}
+
+func CompileSpec(r io.Reader) (lexer *Lexer, err error) {
+	/*
+		读取完整的规则文件，依次经过语法解析，NFA构造，子集构造和DFA最小化，
+		整个过程不打印任何辅助信息，解析时的错误通过error返回
+	*/
+	defer func() {
+		if e := recover(); e != nil {
+			lexer = nil
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+
+	reader := NewLexReaderFrom(r, "<spec>")
+	reader.Verbose = false
+	reader.Head()
+	parser, _ := NewRegParser(reader)
+	rules := parser.ParseAST()
+
+	converter := NewNfaDfaConverter()
+	converter.Verbose = false
+	converter.Options = reader.Options
+	converter.MakeDTranFrom(NewAstNfaConverter().MakeNFAs(rules, reader.StartConditions))
+	converter.MinimizeDFA()
+
+	return &Lexer{
+		Rules:      rules,
+		Options:    reader.Options,
+		Conditions: reader.StartConditions,
+		EOFRules:   reader.EOFRules,
+		tables:     converter.Tables(rules),
+	}, nil
+}
+
+// 扫描器每次从输入中读取的字节数
+const READ_SIZE = 4096
+
+// 一个token读入的字符超过 %option maxtoken= 设置的长度时返回的错误
+var ErrTokenTooLong = errors.New("token too long")
+
+// 开始条件栈为空时调用PopCondition或TopCondition返回的错误
+var ErrConditionStackEmpty = errors.New("start-condition stack underflow")
+
+// Scanner.PushInput保存的输入，PopInput时恢复
+type inputSource struct {
+	input      io.Reader
+	buffer     []byte
+	pos        int
+	eof        bool
+	bol        bool
+	cur        Position
+	eofMatched bool
+}
+
+// Scanner和PushScanner共用的开始条件以及PushCondition保存的开始条件
+type conditionStack struct {
+	condition  int //当前的开始条件
+	conditions []int
+}
+
+func (c *conditionStack) begin(conditions []*StartCondition, name string) error {
+	for i, condition := range conditions {
+		if condition.Name == name {
+			c.condition = i
+			return nil
+		}
+	}
+
+	return fmt.Errorf("undeclared start condition %s", name)
+}
+
+func (c *conditionStack) push(conditions []*StartCondition, name string) error {
+	current := c.condition
+	if err := c.begin(conditions, name); err != nil {
+		return err
+	}
+
+	c.conditions = append(c.conditions, current)
+	return nil
+}
+
+func (c *conditionStack) pop() bool {
+	//栈为空时返回false
+	if len(c.conditions) == 0 {
+		return false
+	}
+
+	c.condition = c.conditions[len(c.conditions)-1]
+	c.conditions = c.conditions[:len(c.conditions)-1]
+	return true
+}
+
+func (c *conditionStack) top() (int, bool) {
+	if len(c.conditions) == 0 {
+		return 0, false
+	}
+
+	return c.conditions[len(c.conditions)-1], true
+}
+
+type Scanner struct {
+	lexer     *Lexer
+	input     io.Reader
+	buffer    []byte   //还没有处理的输入，开头可能保留着yymore需要的上一个token
+	pos       int      //下一个token在buffer中的起始下标
+	eof       bool     //input已经读完
+	bol       bool     //pos为0时，下一个token是否从行首开始
+	cur       Position //下一个token的起始位置
+	last      *Token   //最近一次Next返回的token，Less和More作用于它
+	moreLen   int      //调用More之后，下一个token要包含buffer中pos之前的这么多字符
+	moreStart Position
+	//Reject需要的信息: 最近一次匹配时读入每个字符后的状态，以及匹配开始时的位置
+	states     []int
+	eols       []bool
+	matchPos   int
+	matchCur   Position
+	matchMore  int
+	lastLen    int
+	eofMatched bool           //当前输入的<<EOF>>规则已经返回过
+	inputs     []*inputSource //被PushInput打断的输入
+	conditionStack
+}
+
+func (l *Lexer) Scan(r io.Reader) *Scanner {
+	//每个Scanner有自己的输入和位置，同一个Lexer可以创建多个Scanner
+	return &Scanner{
+		lexer: l,
+		input: r,
+		bol:   true,
+		cur:   Position{Offset: 0, Line: 1, Column: 1},
+	}
+}
+
+func (s *Scanner) atBOL() bool {
+	if s.pos == 0 {
+		return s.bol
+	}
+
+	return s.buffer[s.pos-1] == '\n'
+}
+
+func (s *Scanner) fill() (bool, error) {
+	/*
+		读入更多的输入，返回false表示输入已经结束。已经返回的token从缓冲区中删除，
+		因此缓冲区的大小只和最长的token有关，不需要把全部输入读入内存
+	*/
+	if s.eof {
+		return false, nil
+	}
+
+	if keep := s.pos - s.moreLen; keep > 0 {
+		s.bol = s.atBOL()
+		s.buffer = append(s.buffer[:0], s.buffer[keep:]...)
+		s.pos -= keep
+	}
+
+	for {
+		n := len(s.buffer)
+		if cap(s.buffer)-n < READ_SIZE {
+			buffer := make([]byte, n, 2*cap(s.buffer)+READ_SIZE)
+			copy(buffer, s.buffer)
+			s.buffer = buffer
+		}
+		read, err := s.input.Read(s.buffer[n:cap(s.buffer)])
+		s.buffer = s.buffer[:n+read]
+		if err == io.EOF {
+			s.eof = true
+			return read > 0, nil
+		}
+		if err != nil {
+			return read > 0, err
+		}
+		if read > 0 {
+			return true, nil
+		}
+	}
+}
+
+func (s *Scanner) Next() (*Token, error) {
+	/*
+		返回下一个token，输入结束时返回io.EOF。
+		和生成的代码一样采用最长匹配，长度相同时排在前面的规则胜出
+	*/
+	if s.pos == len(s.buffer) {
+		more, err := s.fill()
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			return s.endOfInput()
+		}
+	}
+
+	tables := s.lexer.tables
+	state := tables.Starts[s.condition]
+	if s.atBOL() {
+		state = tables.BOLStarts[s.condition]
+	}
+	lastRule := UNMATCHED
+	lastLen := 1
+	s.states = s.states[:0]
+	s.eols = s.eols[:0]
+	for n := 0; ; n++ {
+		state = tables.Next(state, int(s.buffer[s.pos+n]))
+		if state == F {
+			break
+		}
+		if n >= s.lexer.Options.MaxToken {
+			if lastRule != UNMATCHED {
+				//超出长度之前已经有规则接收，返回最长的那个匹配
+				break
+			}
+			return nil, fmt.Errorf("%s: %w, exceeds maxtoken=%d", s.cur, ErrTokenTooLong, s.lexer.Options.MaxToken)
+		}
+		//多读入一个字符，用来判断$结尾的规则能否接收
+		if s.pos+n+1 == len(s.buffer) {
+			if _, err := s.fill(); err != nil {
+				return nil, err
+			}
+		}
+		end := s.pos+n+1 == len(s.buffer)
+		eol := end || s.buffer[s.pos+n+1] == '\n' || s.buffer[s.pos+n+1] == '\r'
+		s.states = append(s.states, state)
+		s.eols = append(s.eols, eol)
+		rule := tables.AcceptRule[state]
+		if eol {
+			//下一个字符是换行符或者输入已经结束，$结尾的规则可以接收
+			rule = tables.AcceptEOLRule[state]
+		}
+		if rule != UNMATCHED {
+			lastRule = rule
+			lastLen = n + 1
+		}
+		if end {
+			break
+		}
+	}
+
+	s.matchPos = s.pos
+	s.matchCur = s.cur
+	s.matchMore = s.moreLen
+	return s.token(lastRule, lastLen), nil
+}
+
+func (s *Scanner) endOfInput() (*Token, error) {
+	/*
+		当前输入结束时，如果当前开始条件有<<EOF>>规则，先返回一个Rule为END_OF_FILE的空token，
+		调用者可以借此PushInput新的输入或者改变开始条件。之后再调用Next时，
+		被PushInput打断的输入自动恢复，没有被打断的输入时返回io.EOF
+	*/
+	if !s.eofMatched {
+		s.eofMatched = true
+		if rule := eofRuleFor(s.lexer.EOFRules, s.condition); rule != nil {
+			s.last = nil
+			return &Token{Rule: END_OF_FILE, Name: rule.Name, Lexeme: []byte{}, Start: s.cur, End: s.cur}, nil
+		}
+	}
+
+	if s.PopInput() {
+		return s.Next()
+	}
+
+	return nil, io.EOF
+}
+
+func (s *Scanner) Begin(name string) error {
+	//和lex的BEGIN一样切换开始条件，之后的token只匹配在该开始条件下有效的规则
+	return s.begin(s.lexer.Conditions, name)
+}
+
+func (s *Scanner) PushCondition(name string) error {
+	//和flex的yy_push_state一样把当前开始条件压栈，然后切换到name，PopCondition时切换回来
+	return s.push(s.lexer.Conditions, name)
+}
+
+func (s *Scanner) PopCondition() error {
+	//和flex的yy_pop_state一样切换到栈顶的开始条件并把它出栈
+	if !s.pop() {
+		return fmt.Errorf("%s: %w", s.cur, ErrConditionStackEmpty)
+	}
+
+	return nil
+}
+
+func (s *Scanner) TopCondition() (string, error) {
+	//和flex的yy_top_state一样返回栈顶的开始条件，不改变当前开始条件
+	top, ok := s.top()
+	if !ok {
+		return "", fmt.Errorf("%s: %w", s.cur, ErrConditionStackEmpty)
+	}
+
+	return s.lexer.Conditions[top].Name, nil
+}
+
+func (s *Scanner) Condition() string {
+	//返回当前开始条件的名称，相当于lex的YY_START
+	return s.lexer.Conditions[s.condition].Name
+}
+
+func (s *Scanner) PushInput(r io.Reader) {
+	/*
+		和flex的yypush_buffer_state一样暂停当前输入，之后的token从r读取，
+		r读完之后恢复原来的输入，例如实现include。每个输入的token位置从1:1开始单独计算
+	*/
+	s.inputs = append(s.inputs, &inputSource{
+		input:      s.input,
+		buffer:     s.buffer,
+		pos:        s.pos,
+		eof:        s.eof,
+		bol:        s.atBOL(),
+		cur:        s.cur,
+		eofMatched: s.eofMatched,
+	})
+	s.input = r
+	s.buffer = nil
+	s.pos = 0
+	s.eof = false
+	s.bol = true
+	s.cur = Position{Offset: 0, Line: 1, Column: 1}
+	s.eofMatched = false
+	s.moreLen = 0
+	s.last = nil
+}
+
+func (s *Scanner) PopInput() bool {
+	//和flex的yypop_buffer_state一样放弃当前输入，恢复被PushInput打断的输入，没有被打断的输入时返回false
+	if len(s.inputs) == 0 {
+		return false
+	}
+
+	saved := s.inputs[len(s.inputs)-1]
+	s.inputs = s.inputs[:len(s.inputs)-1]
+	s.input = saved.input
+	s.buffer = saved.buffer[saved.pos:]
+	s.pos = 0
+	s.eof = saved.eof
+	s.bol = saved.bol
+	s.cur = saved.cur
+	s.eofMatched = saved.eofMatched
+	s.moreLen = 0
+	s.last = nil
+	return true
+}
+
+func (s *Scanner) token(rule int, length int) *Token {
+	//把从pos开始的length个字符作为规则rule匹配的token返回
+	start := s.cur
+	if s.moreLen > 0 {
+		start = s.moreStart
+	}
+	lexeme := make([]byte, s.moreLen+length)
+	copy(lexeme, s.buffer[s.pos-s.moreLen:s.pos+length])
+	token := s.lexer.newToken(rule, lexeme, start)
+	s.cur = token.End
+	s.pos += length
+	s.moreLen = 0
+	s.last = token
+	s.lastLen = length
+	return token
+}
+
+func (s *Scanner) Reject() *Token {
+	/*
+		和lex的REJECT一样放弃上一个token，返回次优的匹配: 先是同样长度下排在后面的规则，
+		然后是更短的匹配，都没有时返回只有一个字符的UNMATCHED。
+		必须在下一次调用Next之前调用，Less和Unput之后调用的结果没有意义
+	*/
+	if s.last == nil || s.last.Rule == UNMATCHED {
+		return s.last
+	}
+
+	s.pos = s.matchPos
+	s.cur = s.matchCur
+	s.moreLen = s.matchMore
+	rule, length := s.lexer.tables.NextMatch(s.states, s.eols, s.last.Rule, s.lastLen)
+	return s.token(rule, length)
+}
+
+func (s *Scanner) Less(n int) {
+	/*
+		和lex的yyless(n)一样，只保留上一个token的前n个字符，其余的字符退回输入，
+		下一次调用Next时重新匹配。上一个token的Lexeme和End会随之改变
+	*/
+	token := s.last
+	if token == nil || n < 0 || n > len(token.Lexeme) {
+		panic(fmt.Sprintf("Less(%d) out of range of the last token", n))
+	}
+
+	s.pos -= len(token.Lexeme) - n
+	token.Lexeme = token.Lexeme[:n]
+	token.End = token.Start.advance(token.Lexeme, s.lexer.Options.TabWidth)
+	s.cur = token.End
+}
+
+func (s *Scanner) Unput(c byte) {
+	//和lex的unput(c)一样把字符c退回输入，下一次调用Next时从c开始匹配，c也计入token的位置
+	s.buffer = append(s.buffer, 0)
+	copy(s.buffer[s.pos+1:], s.buffer[s.pos:])
+	s.buffer[s.pos] = c
+}
+
+func (s *Scanner) More() {
+	//和lex的yymore()一样，下一次调用Next返回的token包含上一个token的内容
+	if s.last == nil {
+		return
+	}
+
+	s.moreLen = len(s.last.Lexeme)
+	s.moreStart = s.last.Start
+}
+
+func (l *Lexer) newToken(rule int, lexeme []byte, start Position) *Token {
+	token := &Token{
+		Rule:   rule,
+		Lexeme: lexeme,
+		Start:  start,
+		End:    start.advance(lexeme, l.Options.TabWidth),
+	}
+	if rule != UNMATCHED {
+		token.Name = l.Rules[rule].Name
+	}
+
+	return token
+}
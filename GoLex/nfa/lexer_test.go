@@ -0,0 +1,228 @@
+package nfa
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func scanAll(t *testing.T, lexer *Lexer, input string) []*Token {
+	scanner := lexer.Scan(strings.NewReader(input))
+	tokens := make([]*Token, 0)
+	for {
+		token, err := scanner.Next()
+		if err == io.EOF {
+			return tokens
+		}
+		require.Nil(t, err)
+		tokens = append(tokens, token)
+	}
+}
+
+func TestCompileSpec(t *testing.T) {
+	spec := "%include <std/numbers>\n%%\nif   {}\n[a-z]+   {}\n{INTEGER}   {}\n[ \\t\\n]+   {}\n%%\n"
+	lexer, err := CompileSpec(strings.NewReader(spec))
+	require.Nil(t, err)
+	require.Equal(t, 4, len(lexer.Rules))
+
+	tokens := scanAll(t, lexer, "if iff\n 42?")
+	pos := func(offset, line, column int) Position {
+		return Position{Offset: offset, Line: line, Column: column}
+	}
+	require.Equal(t, []*Token{
+		{Rule: 0, Name: "if", Lexeme: []byte("if"), Start: pos(0, 1, 1), End: pos(2, 1, 3)},
+		{Rule: 3, Name: "[ \\t\\n]+", Lexeme: []byte(" "), Start: pos(2, 1, 3), End: pos(3, 1, 4)},
+		{Rule: 1, Name: "[a-z]+", Lexeme: []byte("iff"), Start: pos(3, 1, 4), End: pos(6, 1, 7)},
+		{Rule: 3, Name: "[ \\t\\n]+", Lexeme: []byte("\n "), Start: pos(6, 1, 7), End: pos(8, 2, 2)},
+		{Rule: 2, Name: "{INTEGER}", Lexeme: []byte("42"), Start: pos(8, 2, 2), End: pos(10, 2, 4)},
+		{Rule: UNMATCHED, Lexeme: []byte("?"), Start: pos(10, 2, 4), End: pos(11, 2, 5)},
+	}, tokens)
+}
+
+func TestCompileSpecAnchors(t *testing.T) {
+	lexer, err := CompileSpec(strings.NewReader("%%\n^#[a-z]+   {}\n[a-z]+$   {}\n[a-z]+   {}\n.|\\n   {}\n"))
+	require.Nil(t, err)
+
+	rules := make([]int, 0)
+	for _, token := range scanAll(t, lexer, "#if x #y\nab") {
+		rules = append(rules, token.Rule)
+	}
+	require.Equal(t, []int{0, 3, 2, 3, 3, 1, 3, 1}, rules)
+}
+
+func TestCompileSpecError(t *testing.T) {
+	_, err := CompileSpec(strings.NewReader("%%\n{NOPE}+   {}\n"))
+	require.EqualError(t, err, "Macro doesn't exist")
+
+	_, err = CompileSpec(strings.NewReader("%option bogus\n%%\na   {}\n"))
+	require.EqualError(t, err, "<spec>:1: illegal option :bogus")
+}
+
+func TestCompileSpecTabWidth(t *testing.T) {
+	lexer, err := CompileSpec(strings.NewReader("%option tabwidth=4\n%%\n[a-z]+   {}\n[ \\t]   {}\n"))
+	require.Nil(t, err)
+
+	columns := make([]int, 0)
+	for _, token := range scanAll(t, lexer, "\tx \ty\t") {
+		columns = append(columns, token.Start.Column)
+	}
+	require.Equal(t, []int{1, 5, 6, 7, 9, 10}, columns)
+}
+
+func TestScannerRefill(t *testing.T) {
+	//每次只读入一个字节，token跨越多次读入时结果不变
+	lexer, err := CompileSpec(strings.NewReader("%%\n^#[a-z]+   {}\n[a-z]+$   {}\n[a-z]+   {}\n.|\\n   {}\n"))
+	require.Nil(t, err)
+	input := "#if x #y\nab\n#z\r\nq"
+	expected := scanAll(t, lexer, input)
+
+	scanner := lexer.Scan(iotest.OneByteReader(strings.NewReader(input)))
+	tokens := make([]*Token, 0)
+	for {
+		token, err := scanner.Next()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		tokens = append(tokens, token)
+	}
+	require.Equal(t, expected, tokens)
+}
+
+func TestScannerMaxToken(t *testing.T) {
+	lexer, err := CompileSpec(strings.NewReader("%option maxtoken=4\n%%\n@[a-z]+;   {}\n[a-z]+   {}\n[ ]   {}\n"))
+	require.Nil(t, err)
+
+	//超出长度之前已经有规则接收时返回那个匹配，否则返回错误
+	scanner := lexer.Scan(strings.NewReader("abcde @ab; @abcde;"))
+	for _, expected := range []string{"abcd", "e", " ", "@ab;", " "} {
+		token, err := scanner.Next()
+		require.Nil(t, err)
+		require.Equal(t, expected, string(token.Lexeme))
+	}
+	_, err = scanner.Next()
+	require.True(t, errors.Is(err, ErrTokenTooLong))
+	require.EqualError(t, err, "1:12: token too long, exceeds maxtoken=4")
+}
+
+func TestScannerPushback(t *testing.T) {
+	lexer, err := CompileSpec(strings.NewReader("%%\n[a-z]+   {}\n[0-9]+   {}\n[ ]   {}\n"))
+	require.Nil(t, err)
+	scanner := lexer.Scan(strings.NewReader("hello 42"))
+
+	token, err := scanner.Next()
+	require.Nil(t, err)
+	scanner.Less(2)
+	require.Equal(t, "he", string(token.Lexeme))
+	require.Equal(t, Position{Offset: 2, Line: 1, Column: 3}, token.End)
+
+	token, err = scanner.Next()
+	require.Nil(t, err)
+	require.Equal(t, "llo", string(token.Lexeme))
+	scanner.More()
+	scanner.Unput('x')
+
+	token, err = scanner.Next()
+	require.Nil(t, err)
+	require.Equal(t, "llox", string(token.Lexeme))
+	require.Equal(t, 2, token.Start.Offset)
+
+	token, err = scanner.Next()
+	require.Nil(t, err)
+	require.Equal(t, " ", string(token.Lexeme))
+	token, err = scanner.Next()
+	require.Nil(t, err)
+	require.Equal(t, "42", string(token.Lexeme))
+}
+
+func TestScannerReject(t *testing.T) {
+	lexer, err := CompileSpec(strings.NewReader("%%\nabc   {}\nab   {}\n[a-z]+$   {}\n[a-z]   {}\n"))
+	require.Nil(t, err)
+	scanner := lexer.Scan(strings.NewReader("abc"))
+
+	token, err := scanner.Next()
+	require.Nil(t, err)
+	require.Equal(t, 0, token.Rule)
+	expected := []struct {
+		rule   int
+		lexeme string
+	}{{2, "abc"}, {1, "ab"}, {3, "a"}, {UNMATCHED, "a"}, {UNMATCHED, "a"}}
+	for _, e := range expected {
+		token = scanner.Reject()
+		require.Equal(t, e.rule, token.Rule)
+		require.Equal(t, e.lexeme, string(token.Lexeme))
+	}
+
+	token, err = scanner.Next()
+	require.Nil(t, err)
+	require.Equal(t, "bc", string(token.Lexeme))
+	require.Equal(t, 2, token.Rule)
+}
+
+func TestScannerStartConditionsAndInputs(t *testing.T) {
+	spec := "%x STR\n%%\n\\\"   {}\n[a-z]+   {}\n@[a-z]+   {}\n<STR>[^\"]+   {}\n<STR>\\\"   {}\n[ \\n]   {}\n<STR><<EOF>>   {}\n<<EOF>>   {}\n%%\n"
+	lexer, err := CompileSpec(strings.NewReader(spec))
+	require.Nil(t, err)
+
+	//@name 把名称对应的内容作为新的输入，读完后回到原来的输入
+	files := map[string]string{"inc": "x \"in", "two": "y"}
+	scanner := lexer.Scan(strings.NewReader("a @inc q\" b @two"))
+	result := ""
+	for {
+		token, err := scanner.Next()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		switch token.Rule {
+		case 0:
+			require.Nil(t, scanner.Begin("STR"))
+		case 2:
+			scanner.PushInput(strings.NewReader(files[string(token.Lexeme[1:])]))
+			continue
+		case 4:
+			require.Nil(t, scanner.Begin(INITIAL))
+		case END_OF_FILE:
+			result += "<" + scanner.Condition() + ">"
+			continue
+		}
+		result += string(token.Lexeme) + "|"
+	}
+	require.Equal(t, "a| |x| |\"|in|<STR> q|\"| |b| |y|<INITIAL><INITIAL>", result)
+	require.EqualError(t, scanner.Begin("NOPE"), "undeclared start condition NOPE")
+}
+
+func TestScannerConditionStack(t *testing.T) {
+	lexer, err := CompileSpec(strings.NewReader("%x STR\n%%\n\\\"   {}\n<STR>\\\"   {}\n<STR>\"${\"   {}\n\\}   {}\n<STR>[^\"$]+   {}\n[a-z]+   {}\n%%\n"))
+	require.Nil(t, err)
+
+	//conditions记录每次压栈之后的栈顶
+	scanner := lexer.Scan(strings.NewReader(`a"s${b}"}`))
+	conditions := make([]string, 0)
+	for {
+		token, err := scanner.Next()
+		require.Nil(t, err)
+		switch token.Rule {
+		case 0, 2:
+			next := "STR"
+			if token.Rule == 2 {
+				next = INITIAL
+			}
+			require.Nil(t, scanner.PushCondition(next))
+			top, err := scanner.TopCondition()
+			require.Nil(t, err)
+			conditions = append(conditions, top)
+		case 1, 3:
+			if err := scanner.PopCondition(); err != nil {
+				require.True(t, errors.Is(err, ErrConditionStackEmpty))
+				require.EqualError(t, err, "1:10: start-condition stack underflow")
+				require.Equal(t, []string{INITIAL, "STR"}, conditions)
+				return
+			}
+		}
+	}
+}
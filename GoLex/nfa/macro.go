@@ -4,16 +4,22 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"unicode"
 )
 
 type Macro struct {
 	//例如  "D  [0-9]" 那么D就是宏定义的名称，[0-9]就是内容
-	Name string
-	Text string
+	Name   string
+	Params []string //参数名称，没有参数时为nil
+	Text   string
 }
 
+// 宏定义展开时默认允许的最大嵌套层数，可以通过 %option macrodepth= 修改
+const MACRO_MAX_DEPTH = 16
+
 type MacroManager struct {
 	macroMap map[string]*Macro
+	Warnings []string //重复定义等不影响解析的问题
 }
 
 var macroManagerInstance *MacroManager
@@ -34,15 +40,51 @@ func newMacroManager() *MacroManager {
 
 func (m *MacroManager) PrintMacs() {
 	for _, val := range m.macroMap {
-		fmt.Sprintf("mac name: %s, text %s: ", val.Name, val.Text)
+		fmt.Printf("mac name: %s, text %s: \n", val.Signature(), val.Text)
 	}
 }
 
+func (m *Macro) Signature() string {
+	//带参数的宏定义显示为 QUOTED(q) 的形式
+	if m.Params == nil {
+		return m.Name
+	}
+
+	return m.Name + "(" + strings.Join(m.Params, ",") + ")"
+}
+
 func (m *MacroManager) NewMacro(line string) (*Macro, error) {
-	//输入对应宏定义的一行内容例如 D [0-9]
+	/*
+		输入对应宏定义的一行内容例如 D [0-9]，名称后面直到行尾的内容都属于宏定义，
+		因此内容里可以包含空白，例如 WS [ \t]+
+		宏定义还可以带参数，例如 QUOTED(q)  {q}([^{q}\\]|\\.)*{q}
+	*/
 	line = strings.TrimSpace(line)
-	nameAndText := strings.Fields(line)
-	if len(nameAndText) != 2 {
+	end := strings.IndexAny(line, " \t(")
+	if end == -1 {
+		return nil, errors.New("macro string error ")
+	}
+	name := line[0:end]
+
+	var params []string
+	if line[end] == '(' {
+		paramEnd := strings.IndexByte(line, ')')
+		if paramEnd == -1 {
+			return nil, fmt.Errorf("missing ) in parameters of macro %s", name)
+		}
+		params = make([]string, 0)
+		for _, param := range strings.Split(line[end+1:paramEnd], ",") {
+			param = strings.TrimSpace(param)
+			if param == "" {
+				return nil, fmt.Errorf("empty parameter name in macro %s", name)
+			}
+			params = append(params, param)
+		}
+		end = paramEnd + 1
+	}
+
+	text := strings.TrimSpace(line[end:])
+	if text == "" {
 		return nil, errors.New("macro string error ")
 	}
 
@@ -51,11 +93,16 @@ func (m *MacroManager) NewMacro(line string) (*Macro, error) {
 		例如 :
 		D  [0-9]
 		D  [a-z]
-		那么我们采用最后一个定义也就是D被扩展成[a-z]
+		那么我们采用最后一个定义也就是D被扩展成[a-z], 同时给出警告
 	*/
+	if old, ok := m.macroMap[name]; ok {
+		m.Warnings = append(m.Warnings, fmt.Sprintf("macro %s redefined, %s replaced by %s", name, old.Text, text))
+	}
+
 	macro := &Macro{
-		Name: nameAndText[0],
-		Text: nameAndText[1],
+		Name:   name,
+		Params: params,
+		Text:   text,
 	}
 
 	m.macroMap[macro.Name] = macro
@@ -67,24 +114,63 @@ func (m *MacroManager) ExpandMacro(macroStr string) string {
 			输入: D}, 然后该函数将其转换为[0-9]
 		    左括号会被调用函数去除
 	*/
-	valid := false
-	macroName := ""
-	for pos, char := range macroStr {
-		if char == '}' {
-			valid = true
-			macroName = macroStr[0:pos]
-			break
-		}
-	}
+	_, _, text, _ := m.ExpandMacroCall(macroStr)
+	return text
+}
 
-	if valid != true {
+func (m *MacroManager) ExpandMacroCall(macroStr string) (string, []string, string, string) {
+	/*
+		输入: QUOTED(")}*{D}, 返回宏定义的名称QUOTED, 调用时写的参数["], 把参数代入后的内容以及右括号后面剩余的字符串*{D}
+		参数之间用逗号隔开，参数列表以 )} 结束，因此参数本身可以包含 ( 和 }。没有参数列表时返回的参数是nil
+	*/
+	end := strings.IndexAny(macroStr, "(}")
+	if end == -1 {
 		NewParseError().ParseErr(E_BADREXPR)
 	}
 
+	macroName := macroStr[0:end]
+	var args []string
+	if macroStr[end] == '(' {
+		argEnd := strings.Index(macroStr[end:], ")}")
+		if argEnd == -1 {
+			NewParseError().ParseErr(E_BADMAC)
+		}
+		argEnd += end
+		args = make([]string, 0)
+		if argEnd > end+1 {
+			args = strings.Split(macroStr[end+1:argEnd], ",")
+		}
+		end = argEnd + 1
+	}
+
 	macro, ok := m.macroMap[macroName]
 	if !ok {
 		NewParseError().ParseErr(E_NOMAC)
 	}
 
-	return macro.Text
+	if len(args) != len(macro.Params) {
+		detail := fmt.Sprintf("%s expects %d argument(s), got %d", macro.Signature(), len(macro.Params), len(args))
+		NewParseError().ParseErrDetail(E_MACARGS, detail)
+	}
+
+	return macroName, args, macro.substitute(args), macroStr[end+1:]
+}
+
+func (m *Macro) substitute(args []string) string {
+	/*
+		把宏定义内容中的{参数名}替换成参数，例如 QUOTED(q) 的内容 {q}([^{q}\\]|\\.)*{q}，
+		调用{QUOTED(")}后得到 \"([^\"\\]|\\.)*\"。
+		只有一个字符并且不是字母或数字的参数被当作普通字符，需要加上转义符，
+		否则像 " 这样的参数会被当作字符串的开始
+	*/
+	text := m.Text
+	for i, param := range m.Params {
+		arg := args[i]
+		if len(arg) == 1 && !unicode.IsLetter(rune(arg[0])) && !unicode.IsDigit(rune(arg[0])) {
+			arg = "\\" + arg
+		}
+		text = strings.ReplaceAll(text, "{"+param+"}", arg)
+	}
+
+	return text
 }
@@ -38,3 +38,77 @@ func TestMacroMissingParam(t *testing.T) {
 	_, _ = macroMgr.NewMacro("D [0-9]")
 	assert.Panics(t, func() { macroMgr.ExpandMacro("D") }, "Missing } in macro expansion")
 }
+
+func TestMacroTextWithSpaces(t *testing.T) {
+	macroMgr := newMacroManager()
+	macro, err := macroMgr.NewMacro("WS   [ \t]+ ")
+	require.Nil(t, err)
+	require.Equal(t, "WS", macro.Name)
+	require.Equal(t, "[ \t]+", macro.Text)
+
+	_, err = macroMgr.NewMacro("EMPTY")
+	require.NotNil(t, err)
+}
+
+func TestMacroRedefinedWarning(t *testing.T) {
+	macroMgr := newMacroManager()
+	_, _ = macroMgr.NewMacro("D [0-9]")
+	require.Equal(t, 0, len(macroMgr.Warnings))
+	_, _ = macroMgr.NewMacro("D [a-z]")
+	require.Equal(t, []string{"macro D redefined, [0-9] replaced by [a-z]"}, macroMgr.Warnings)
+}
+
+func TestMacroWhitespaceInClass(t *testing.T) {
+	rules := parseRules(t, "BLANK  [ \\t]\n%%\n{BLANK}+\" \"x   {}\n[ ]y   {}\n%%\n")
+	require.Equal(t, 2, len(rules))
+	require.Equal(t, "{}", rules[0].Action)
+	require.True(t, acceptsString(NewAstNfaConverter().MakeNFA(rules[0:1]), " \t x"))
+	require.True(t, acceptsString(NewAstNfaConverter().MakeNFA(rules[1:2]), " y"))
+}
+
+func TestMacroCycle(t *testing.T) {
+	assert.PanicsWithValue(t, "Macro expansion is recursive: SELF -> SELF", func() {
+		parseRules(t, "SELF  a{SELF}\n%%\n{SELF}   {}\n%%\n")
+	})
+	assert.PanicsWithValue(t, "Macro expansion is recursive: CYA -> CYB -> CYA", func() {
+		parseRules(t, "CYA  a{CYB}\nCYB  b{CYA}\n%%\n{CYA}   {}\n%%\n")
+	})
+}
+
+func TestMacroDepth(t *testing.T) {
+	spec := "%option macrodepth=2\nDA  a\nDB  {DA}b\nDC  {DB}c\n%%\n{DB}   {}\n{DC}   {}\n%%\n"
+	assert.PanicsWithValue(t, "Macro expansions nested too deeply: DC -> DB -> DA", func() {
+		parseRules(t, spec)
+	})
+}
+
+func TestParameterisedMacro(t *testing.T) {
+	macroMgr := newMacroManager()
+	macro, err := macroMgr.NewMacro("PAIR(a, b)  {a}{b}|{b}{a}")
+	require.Nil(t, err)
+	require.Equal(t, []string{"a", "b"}, macro.Params)
+
+	name, args, text, rest := macroMgr.ExpandMacroCall("PAIR(x,[0-9])}*")
+	require.Equal(t, "PAIR", name)
+	require.Equal(t, []string{"x", "[0-9]"}, args)
+	require.Equal(t, "x[0-9]|[0-9]x", text)
+	require.Equal(t, "*", rest)
+
+	assert.PanicsWithValue(t, "Wrong number of macro arguments: PAIR(a,b) expects 2 argument(s), got 1", func() {
+		macroMgr.ExpandMacroCall("PAIR(x)}")
+	})
+	assert.PanicsWithValue(t, "Wrong number of macro arguments: PAIR(a,b) expects 2 argument(s), got 0", func() {
+		macroMgr.ExpandMacroCall("PAIR}")
+	})
+}
+
+func TestQuotedMacro(t *testing.T) {
+	rules := parseRules(t, "QUOTED(q)  {q}([^{q}\\\\]|\\\\.)*{q}\n%%\n{QUOTED(\")}   {}\n{QUOTED(')}   {}\n%%\n")
+	require.Equal(t, 2, len(rules))
+	double := NewAstNfaConverter().MakeNFA(rules[0:1])
+	require.True(t, acceptsString(double, `"a\"b"`))
+	require.False(t, acceptsString(double, `"a"b"`))
+	single := NewAstNfaConverter().MakeNFA(rules[1:2])
+	require.True(t, acceptsString(single, `'it\'s'`))
+	require.False(t, acceptsString(single, `"x"`))
+}
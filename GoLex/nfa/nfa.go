@@ -5,6 +5,7 @@ type EdgeType int
 const (
 	EPSILON = -1 //epsilon 边
 	CCL     = -2 //边对应输入是字符集
+	BOL     = -3 //^ 对应的边，只有在行首时才能通过，不消耗字符
 )
 
 type Anchor int
@@ -25,6 +26,7 @@ type NFA struct {
 	next   *NFA //一个nfa节点最多有两条边
 	next2  *NFA
 	accept string //当进入接收状态后要执行的代码
+	rule   int    //接收节点对应第几条规则
 	anchor Anchor //表达式是否在开头包含^或是在结尾包含$
 }
 
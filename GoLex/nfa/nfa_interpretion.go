@@ -3,6 +3,7 @@ package nfa
 import (
 	"fmt"
 	"math"
+	"sort"
 )
 
 type EpsilonResult struct {
@@ -13,6 +14,15 @@ type EpsilonResult struct {
 	acceptStr   string
 	hasAccepted bool
 	anchor      Anchor
+	rule        int   //接收节点对应的规则
+	accepts     []int //集合中所有接收节点对应的规则，从小到大排列
+	/*
+		不带$的接收节点中状态值最小的那个，带$的规则只有在下一个字符是换行符或者输入结束时才能接收，
+		否则使用这里的结果
+	*/
+	plainStr  string
+	hasPlain  bool
+	plainRule int
 }
 
 func stackContains(stack []*NFA, elem *NFA) bool {
@@ -27,6 +37,7 @@ func stackContains(stack []*NFA, elem *NFA) bool {
 
 func EpsilonClosure(input []*NFA) *EpsilonResult {
 	acceptState := math.MaxInt
+	plainState := math.MaxInt
 	result := &EpsilonResult{}
 
 	for len(input) > 0 {
@@ -37,18 +48,30 @@ func EpsilonClosure(input []*NFA) *EpsilonResult {
 		/*
 			如果有多个终结节点，那么选取状态值最小的那个作为接收点
 		*/
+		if node.next == nil {
+			result.accepts = insertRule(result.accepts, node.rule)
+		}
 		if node.next == nil && node.state < acceptState {
+			acceptState = node.state
 			result.acceptStr = node.accept
 			result.anchor = node.anchor
+			result.rule = node.rule
 			result.hasAccepted = true
 		}
+		if node.next == nil && node.anchor&END == 0 && node.state < plainState {
+			plainState = node.state
+			result.plainStr = node.accept
+			result.plainRule = node.rule
+			result.hasPlain = true
+		}
 
 		if node.edge == EPSILON {
-			if node.next != nil && stackContains(input, node.next) == false {
+			//嵌套的闭包会形成epsilon环，已经加入结果集合的节点不能再次处理
+			if node.next != nil && stackContains(input, node.next) == false && stackContains(result.results, node.next) == false {
 				input = append(input, node.next)
 			}
 
-			if node.next2 != nil && stackContains(input, node.next2) == false {
+			if node.next2 != nil && stackContains(input, node.next2) == false && stackContains(result.results, node.next2) == false {
 				input = append(input, node.next2)
 			}
 		}
@@ -57,10 +80,46 @@ func EpsilonClosure(input []*NFA) *EpsilonResult {
 	return result
 }
 
+func BolClosure(input []*NFA) (*EpsilonResult, bool) {
+	/*
+		在行首时 ^ 对应的边可以直接通过，把这些边指向的节点也加入闭包。
+		如果闭包中没有 ^ 对应的边，那么第二个返回值为false
+	*/
+	result := EpsilonClosure(input)
+	nodes := make([]*NFA, len(result.results))
+	copy(nodes, result.results)
+	hasBol := false
+	for _, node := range result.results {
+		if node.edge == BOL && !stackContains(nodes, node.next) {
+			nodes = append(nodes, node.next)
+			hasBol = true
+		}
+	}
+
+	if !hasBol {
+		return result, false
+	}
+
+	return EpsilonClosure(nodes), true
+}
+
+func insertRule(rules []int, rule int) []int {
+	//把规则编号插入有序的集合
+	pos := sort.SearchInts(rules, rule)
+	if pos < len(rules) && rules[pos] == rule {
+		return rules
+	}
+
+	rules = append(rules, 0)
+	copy(rules[pos+1:], rules[pos:])
+	rules[pos] = rule
+	return rules
+}
+
 func move(input []*NFA, c int) []*NFA {
 	result := make([]*NFA, 0)
 	for _, elem := range input {
-		if int(elem.edge) == c || (elem.edge == CCL && elem.bitset[string(c)] == true) {
+		if int(elem.edge) == c || (elem.edge == CCL && elem.bitset[string(rune(c))] == true) {
 			result = append(result, elem.next)
 		}
 	}
@@ -100,7 +159,8 @@ func NfaMatchString(state *NFA, str string) bool {
 	startStates = append(startStates, state)
 	statesCopied := make([]*NFA, len(startStates))
 	copy(statesCopied, startStates)
-	result := EpsilonClosure(statesCopied)
+	//字符串的开头也是行首，因此 ^ 开头的表达式可以匹配
+	result, _ := BolClosure(statesCopied)
 
 	printEpsilonClosure(startStates, result.results)
 
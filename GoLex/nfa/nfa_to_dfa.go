@@ -1,6 +1,7 @@
 package nfa
 
 import (
+	"errors"
 	"fmt"
 )
 
@@ -10,6 +11,9 @@ const (
 	MAX_CHARS = 128 //128个ascii字符
 )
 
+// ErrTooManyDFAStates 表示DFA的节点数超过了DFA_MAX
+var ErrTooManyDFAStates = errors.New("Too many DFA states")
+
 type ACCEPT struct {
 	acceptString string //接收节点对应的执行代码字符串
 	anchor       Anchor
@@ -23,6 +27,11 @@ type DFA struct {
 	state        int    //dfa 节点号码
 	acceptString string
 	isAccepted   bool
+	plainString  string //下一个字符不是换行符时执行的代码，见EpsilonResult
+	hasPlain     bool
+	plainRule    int
+	rule         int   //接收状态对应的规则，多条规则同时匹配时取最前面的一条
+	accepts      []int //所有能在该状态匹配的规则
 }
 
 type NfaDfaConverter struct {
@@ -34,6 +43,11 @@ type NfaDfaConverter struct {
 	groups     [][]int //用于dfa节点分区
 	inGroups   []int   //根据节点值给出其所在分区
 	numGroups  int     //当前分区数
+	bolStart   int     //行首时使用的起始状态，没有^开头的规则时就是状态0
+	starts     []int   //每个开始条件对应的起始状态
+	bolStarts  []int   //每个开始条件在行首时使用的起始状态
+	Verbose    bool    //打印辅助信息
+	Options    *LexOptions
 }
 
 func NewNfaDfaConverter() *NfaDfaConverter {
@@ -45,6 +59,8 @@ func NewNfaDfaConverter() *NfaDfaConverter {
 		groups:     make([][]int, DFA_MAX),
 		inGroups:   make([]int, DFA_MAX),
 		numGroups:  0,
+		Verbose:    true,
+		Options:    NewLexOptions(),
 	}
 
 	for i := range n.dtrans {
@@ -60,11 +76,6 @@ func NewNfaDfaConverter() *NfaDfaConverter {
 
 func (n *NfaDfaConverter) getUnMarked() *DFA {
 	for ; n.lastMarked < n.nstates; n.lastMarked++ {
-		debug := 0
-		if n.dstates[n.lastMarked].state == 5 {
-			debug = 1
-			fmt.Printf("debug: %d", debug)
-		}
 		if n.dstates[n.lastMarked].mark == false {
 			return &n.dstates[n.lastMarked]
 		}
@@ -79,8 +90,8 @@ func (n *NfaDfaConverter) compareNfaSlice(setOne []*NFA, setTwo []*NFA) bool {
 		return false
 	}
 
-	equal := false
 	for _, nfaOne := range setOne {
+		equal := false
 		for _, nfaTwo := range setTwo {
 			if nfaTwo == nfaOne {
 				equal = true
@@ -111,7 +122,7 @@ func (n *NfaDfaConverter) addDfaState(epsilonResult *EpsilonResult) int {
 	//根据当前nfa节点集合构造一个新的dfa节点
 	nextState := F
 	if n.nstates >= DFA_MAX {
-		panic("Too many DFA states")
+		panic(ErrTooManyDFAStates.Error())
 	}
 
 	nextState = n.nstates
@@ -123,10 +134,17 @@ func (n *NfaDfaConverter) addDfaState(epsilonResult *EpsilonResult) int {
 	n.dstates[nextState].isAccepted = epsilonResult.hasAccepted
 
 	n.dstates[nextState].anchor = epsilonResult.anchor
+	n.dstates[nextState].rule = epsilonResult.rule
+	n.dstates[nextState].accepts = epsilonResult.accepts
+	n.dstates[nextState].plainString = epsilonResult.plainStr
+	n.dstates[nextState].hasPlain = epsilonResult.hasPlain
+	n.dstates[nextState].plainRule = epsilonResult.plainRule
 	n.dstates[nextState].state = nextState //记录当前dfa节点的编号s
 
-	n.printDFAState(&n.dstates[nextState])
-	fmt.Print("\n")
+	if n.Verbose {
+		n.printDFAState(&n.dstates[nextState])
+		fmt.Print("\n")
+	}
 
 	return nextState
 }
@@ -142,23 +160,41 @@ func (n *NfaDfaConverter) printDFAState(dfa *DFA) {
 
 func (n *NfaDfaConverter) MakeDTran(start *NFA) {
 	//根据输入的nfa状态机起始节点构造dfa状态机的跳转表
-	startStates := make([]*NFA, 0)
-	startStates = append(startStates, start)
-	statesCopied := make([]*NFA, len(startStates))
-	copy(statesCopied, startStates)
-
-	//先根据起始状态的求Epsilon闭包操作的结果，由此获得第一个dfa节点
-	epsilonResult := EpsilonClosure(statesCopied)
-	n.dstates[0].set = epsilonResult.results
-	n.dstates[0].anchor = epsilonResult.anchor
-	n.dstates[0].acceptString = epsilonResult.acceptStr
-	n.dstates[0].mark = false
-
-	//debug purpose
-	n.printDFAState(&n.dstates[0])
-	fmt.Print("\n")
+	n.MakeDTranFrom([]*NFA{start})
+}
+
+func (n *NfaDfaConverter) MakeDTranFrom(starts []*NFA) {
+	/*
+		每个开始条件对应一个nfa起始节点，见AstNfaConverter.MakeNFAs。所有起始节点共用一个跳转表，
+		第一个开始条件(INITIAL)的起始状态总是0，其余开始条件的起始状态记录在starts中
+	*/
+	if err := n.makeDTran(starts); err != nil {
+		panic(err.Error())
+	}
+}
+
+func (n *NfaDfaConverter) makeDTran(starts []*NFA) error {
+	//和MakeDTranFrom相同，dfa节点数超过DFA_MAX时返回ErrTooManyDFAStates
+	n.nstates = 0
+	n.starts = make([]int, len(starts))
+	n.bolStarts = make([]int, len(starts))
+	for i, start := range starts {
+		//先根据起始状态的求Epsilon闭包操作的结果，由此获得起始的dfa节点
+		if n.nstates+2 > DFA_MAX {
+			return ErrTooManyDFAStates
+		}
+		n.starts[i] = n.startState(EpsilonClosure([]*NFA{start}))
+		//如果有^开头的规则，那么行首时使用另一个起始状态，它还包含^对应边指向的节点
+		n.bolStarts[i] = n.starts[i]
+		if bolResult, hasBol := BolClosure([]*NFA{start}); hasBol {
+			n.bolStarts[i] = n.startState(bolResult)
+		}
+	}
+	n.bolStart = n.bolStarts[0]
+
+	var statesCopied []*NFA
+	var epsilonResult *EpsilonResult
 	nextState := 0
-	n.nstates = 1 //当前已经有一个dfa节点
 	//先获得第一个没有设置其跳转边的dfa节点
 	current := n.getUnMarked()
 	for current != nil {
@@ -178,6 +214,9 @@ func (n *NfaDfaConverter) MakeDTran(start *NFA) {
 				//如果当前没有那个dfa节点对应的nfa节点集合和当前nfaSet相同，那么就增加一个新的dfa节点
 				isExist, state := n.hasDfaContainsNfa(nfaSet)
 				if isExist == false {
+					if n.nstates >= DFA_MAX {
+						return ErrTooManyDFAStates
+					}
 					nextState = n.addDfaState(epsilonResult)
 				} else {
 					nextState = state
@@ -190,6 +229,17 @@ func (n *NfaDfaConverter) MakeDTran(start *NFA) {
 
 		current = n.getUnMarked()
 	}
+
+	return nil
+}
+
+func (n *NfaDfaConverter) startState(epsilonResult *EpsilonResult) int {
+	//不同开始条件的起始节点集合可能相同，这时共用一个dfa节点
+	if isExist, state := n.hasDfaContainsNfa(epsilonResult.results); isExist {
+		return state
+	}
+
+	return n.addDfaState(epsilonResult)
 }
 
 func (n *NfaDfaConverter) PrintDfaTransition() {
@@ -203,26 +253,35 @@ func (n *NfaDfaConverter) PrintDfaTransition() {
 				n.printDFAState(&n.dstates[i])
 				fmt.Print(" jump to : ")
 				n.printDFAState(&n.dstates[n.dtrans[i][j]])
-				fmt.Printf("by character %s\n", string(j))
+				fmt.Printf("by character %s\n", string(rune(j)))
 			}
 		}
 	}
 }
 
 func (n *NfaDfaConverter) initGroups() {
-	//先把节点根据接收状态分为两个分区
+	/*
+		先把节点根据接收状态分区，所有非接收节点为一个分区，接收节点按照要执行的代码以及能匹配的所有规则分区，
+		执行不同代码的接收节点不能合并。状态0总是第一个加入分区0，它在后面的分区过程中不会被挪走，
+		因此最小化后的起始状态依然是0
+	*/
+	groupOfAccept := make(map[string]int)
 	for i := 0; i < n.nstates; i++ {
+		key := "non-accepting"
 		if n.dstates[i].isAccepted {
-			n.groups[1] = append(n.groups[1], n.dstates[i].state)
-			//记录状态点对应的分区
-			n.inGroups[n.dstates[i].state] = 1
-		} else {
-			n.groups[0] = append(n.groups[0], n.dstates[i].state)
-			n.inGroups[n.dstates[i].state] = 0
+			key = fmt.Sprintf("%d:%s:%v", n.dstates[i].anchor, n.dstates[i].acceptString, n.dstates[i].accepts)
 		}
-	}
 
-	n.numGroups = 2
+		group, ok := groupOfAccept[key]
+		if !ok {
+			group = n.numGroups
+			groupOfAccept[key] = group
+			n.numGroups += 1
+		}
+		n.groups[group] = append(n.groups[group], n.dstates[i].state)
+		//记录状态点对应的分区
+		n.inGroups[n.dstates[i].state] = group
+	}
 }
 
 func (n *NfaDfaConverter) printGroups() {
@@ -290,7 +349,9 @@ func (n *NfaDfaConverter) minimizeGroups() {
 		}
 	}
 
-	n.printGroups()
+	if n.Verbose {
+		n.printGroups()
+	}
 }
 
 func (n *NfaDfaConverter) fixTran() {
@@ -311,16 +372,31 @@ func (n *NfaDfaConverter) fixTran() {
 		state := n.groups[i][0]
 		for c := MAX_CHARS - 1; c >= 0; c-- {
 			if n.dtrans[state][c] == F {
-				newDTran[state][c] = F
+				newDTran[i][c] = F
 			} else {
 				destState := n.dtrans[state][c]
 				destPartition := n.inGroups[destState]
-				newDTran[state][c] = destPartition
+				newDTran[i][c] = destPartition
 			}
 		}
 	}
 
 	n.dtrans = newDTran
+	for i := range n.starts {
+		n.starts[i] = n.inGroups[n.starts[i]]
+		n.bolStarts[i] = n.inGroups[n.bolStarts[i]]
+	}
+	n.bolStart = n.bolStarts[0]
+
+	//每个分区对应一个新的DFA节点，节点的接收信息取自分区中的任意一个节点
+	newDStates := make([]DFA, DFA_MAX)
+	for i := 0; i < n.numGroups; i++ {
+		newDStates[i] = n.dstates[n.groups[i][0]]
+		newDStates[i].state = i
+		newDStates[i].group = i
+	}
+	n.dstates = newDStates
+	n.nstates = n.numGroups
 }
 
 func (n *NfaDfaConverter) MinimizeDFA() {
@@ -333,7 +409,7 @@ func (n *NfaDfaConverter) PrintMinimizeDFATran() {
 	for i := 0; i < n.numGroups; i++ {
 		for j := 0; j < MAX_CHARS; j++ {
 			if n.dtrans[i][j] != F {
-				fmt.Printf("from state %d jump to state %d with input: %s\n", i, n.dtrans[i][j], string(j))
+				fmt.Printf("from state %d jump to state %d with input: %s\n", i, n.dtrans[i][j], string(rune(j)))
 			}
 		}
 	}
@@ -0,0 +1,69 @@
+package nfa
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareNfaSlice(t *testing.T) {
+	//每个元素都要在另一个集合中找到，只有第一个元素相同的集合不相等
+	a, b, c := NewNFA(), NewNFA(), NewNFA()
+	n := NewNfaDfaConverter()
+	require.True(t, n.compareNfaSlice([]*NFA{a, b}, []*NFA{b, a}))
+	require.False(t, n.compareNfaSlice([]*NFA{a, b}, []*NFA{a, c}))
+	require.False(t, n.compareNfaSlice([]*NFA{a}, []*NFA{a, b}))
+}
+
+func minimizedDFA(t *testing.T, spec string) *NfaDfaConverter {
+	n := NewNfaDfaConverter()
+	n.Verbose = false
+	n.MakeDTran(parseSpec(t, spec))
+	n.MinimizeDFA()
+	return n
+}
+
+func (n *NfaDfaConverter) walk(input string) *DFA {
+	state := 0
+	for _, c := range []byte(input) {
+		state = n.dtrans[state][c]
+		if state == F {
+			return nil
+		}
+	}
+
+	return &n.dstates[state]
+}
+
+func TestEpsilonClosurePicksLowestAcceptState(t *testing.T) {
+	//闭包中有多个接收节点时选择状态值最小的那个，也就是排在前面的规则
+	nodes := make([]*NFA, 0)
+	for _, state := range []int{5, 2, 7} {
+		node := NewNFA()
+		node.state = state
+		node.accept = fmt.Sprintf("{%d}", state)
+		nodes = append(nodes, node)
+	}
+	require.Equal(t, "{2}", EpsilonClosure(nodes).acceptStr)
+}
+
+func TestMinimizeKeepsDifferentActions(t *testing.T) {
+	//执行不同动作的接收状态不能合并到同一个分区
+	n := minimizedDFA(t, "%%\na   {A}\nb   {B}\n")
+	require.Equal(t, "{A}", n.walk("a").acceptString)
+	require.Equal(t, "{B}", n.walk("b").acceptString)
+}
+
+func TestMinimizeRenumbersStates(t *testing.T) {
+	//最小化后每个分区是一个新的节点，跳转表和节点信息都按照分区编号
+	n := minimizedDFA(t, "%%\nab|cb   {X}\n")
+	require.Equal(t, 3, n.nstates)
+	for _, input := range []string{"ab", "cb"} {
+		state := n.walk(input)
+		require.NotNil(t, state, input)
+		require.True(t, state.isAccepted, input)
+		require.Equal(t, "{X}", state.acceptString, input)
+	}
+	require.Nil(t, n.walk("b"))
+}
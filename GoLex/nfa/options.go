@@ -0,0 +1,181 @@
+package nfa
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Backend int
+
+const (
+	BACKEND_PYTHON Backend = iota //生成python代码
+	BACKEND_GO                    //生成go代码
+	BACKEND_C                     //生成c代码
+)
+
+type TableMode int
+
+const (
+	TABLES_FULL       TableMode = iota //输出完整的二维跳转表
+	TABLES_COMPRESSED                  //相同的行只输出一次
+)
+
+// 默认允许的最长token，和lex的YYLMAX相同
+const MAX_TOKEN_LENGTH = 8192
+
+/*
+LexOptions 对应定义部分的 %option 指令，例如:
+%option prefix=calc package=lexer noyywrap
+%option backend=go tables=compressed
+NfaDfaConverter和所有的代码生成器都从这里读取配置
+*/
+type LexOptions struct {
+	Prefix     string    //生成代码中标识符的前缀，默认是yy，例如yylex
+	Package    string    //生成go代码时的包名
+	NoYYWrap   bool      //读到输入末尾时不调用yywrap
+	YYLineNo   bool      //在yylineno中记录当前行号
+	Caseless   bool      //匹配时忽略大小写
+	OutFile    string    //输出文件名，设置后会覆盖命令行给出的文件名
+	Backend    Backend   //生成哪种语言的代码
+	Tables     TableMode //跳转表的输出形式
+	Simplify   bool      //生成NFA之前是否化简语法树
+	MacroDepth int       //宏定义展开允许的最大嵌套层数
+	AllowEmpty bool      //允许规则匹配空字符串
+	Backup     bool      //和flex -b一样把需要回退的状态写入lex.backup
+	TabWidth   int       //计算token的列号时一个tab占用的宽度
+	MaxToken   int       //匹配一个token时最多读入的字符数，超过时扫描器报错
+	Reentrant  bool      //生成没有包级状态的go扫描器，见codegen_go_reentrant.go
+	ExtraType  string    //可重入扫描器中用户数据yyextra的类型
+	GoYacc     bool      //生成的go扫描器实现goyacc的yyLexer接口，见codegen_go_yacc.go
+	backendSet bool      //是否通过backend=明确指定了生成的语言
+}
+
+func NewLexOptions() *LexOptions {
+	return &LexOptions{
+		Prefix:     "yy",
+		Package:    "main",
+		NoYYWrap:   false,
+		YYLineNo:   false,
+		Caseless:   false,
+		OutFile:    "",
+		Backend:    BACKEND_PYTHON,
+		Tables:     TABLES_FULL,
+		Simplify:   true,
+		MacroDepth: MACRO_MAX_DEPTH,
+		TabWidth:   8,
+		MaxToken:   MAX_TOKEN_LENGTH,
+		ExtraType:  "interface{}",
+	}
+}
+
+func BackendForFile(fileName string) Backend {
+	//没有设置backend时根据输出文件的后缀决定生成哪种代码
+	if strings.HasSuffix(fileName, ".go") {
+		return BACKEND_GO
+	}
+
+	if strings.HasSuffix(fileName, ".c") || strings.HasSuffix(fileName, ".h") {
+		return BACKEND_C
+	}
+
+	return BACKEND_PYTHON
+}
+
+func (o *LexOptions) Set(option string) error {
+	/*
+		设置一个选项，选项有两种形式: name=value 或者 name, 后者前面加上no表示关闭该选项
+	*/
+	name, value, hasValue := strings.Cut(option, "=")
+	if hasValue {
+		value = strings.Trim(value, "\"")
+		switch name {
+		case "prefix":
+			o.Prefix = value
+		case "package":
+			o.Package = value
+		case "outfile":
+			//没有明确指定backend时，根据新的输出文件名决定生成哪种代码
+			o.OutFile = value
+			if !o.backendSet {
+				o.Backend = BackendForFile(value)
+			}
+		case "backend":
+			o.backendSet = true
+			switch value {
+			case "go":
+				o.Backend = BACKEND_GO
+			case "c":
+				o.Backend = BACKEND_C
+			case "python":
+				o.Backend = BACKEND_PYTHON
+			default:
+				return fmt.Errorf("illegal backend :%s", value)
+			}
+		case "tables":
+			switch value {
+			case "full":
+				o.Tables = TABLES_FULL
+			case "compressed":
+				o.Tables = TABLES_COMPRESSED
+			default:
+				return fmt.Errorf("illegal tables :%s", value)
+			}
+		case "macrodepth":
+			depth, err := strconv.Atoi(value)
+			if err != nil || depth <= 0 {
+				return fmt.Errorf("illegal macrodepth :%s", value)
+			}
+			o.MacroDepth = depth
+		case "tabwidth":
+			width, err := strconv.Atoi(value)
+			if err != nil || width <= 0 {
+				return fmt.Errorf("illegal tabwidth :%s", value)
+			}
+			o.TabWidth = width
+		case "maxtoken":
+			length, err := strconv.Atoi(value)
+			if err != nil || length <= 0 {
+				return fmt.Errorf("illegal maxtoken :%s", value)
+			}
+			o.MaxToken = length
+		case "extra-type":
+			o.ExtraType = value
+		default:
+			return fmt.Errorf("illegal option :%s", option)
+		}
+
+		return nil
+	}
+
+	enable := true
+	if strings.HasPrefix(name, "no") && name != "noyywrap" {
+		enable = false
+		name = name[2:]
+	}
+
+	switch name {
+	case "noyywrap":
+		o.NoYYWrap = true
+	case "yywrap":
+		o.NoYYWrap = !enable
+	case "yylineno":
+		o.YYLineNo = enable
+	case "caseless", "case-insensitive":
+		o.Caseless = enable
+	case "simplify":
+		o.Simplify = enable
+	case "allowempty":
+		o.AllowEmpty = enable
+	case "backup":
+		o.Backup = enable
+	case "reentrant":
+		o.Reentrant = enable
+	case "goyacc":
+		o.GoYacc = enable
+	default:
+		return fmt.Errorf("illegal option :%s", option)
+	}
+
+	return nil
+}
@@ -14,6 +14,12 @@ const (
 	E_BADMAC                     //表达式中的宏定义少了右括号}
 	E_NOMAC                      //宏定义不存在
 	E_MACDEPTH                   //宏定义嵌套太深
+	E_CLASSOP                    //{-}, {+} 两边必须是字符集
+	E_MACCYCLE                   //宏定义直接或间接地引用了自己
+	E_MACARGS                    //宏定义调用时参数数量不对
+	E_NULLABLE                   //规则能匹配空字符串
+	E_BADSC                      //规则使用了没有声明的开始条件
+	E_BADTOKEN                   //规则用 => 返回了没有声明的token
 )
 
 type ParseError struct {
@@ -28,10 +34,18 @@ func NewParseError() *ParseError {
 			"Too many regular expressions or expression too long",
 			"Missing [ in character class",
 			"^ must be at start of expression",
+			"+ ? or * must follow an expression or subexpression",
+			"Too many characters in accept actions",
 			"Newline in quoted string, use \\n instead",
 			"Missing } in macro expansion",
 			"Macro doesn't exist",
 			"Macro expansions nested too deeply",
+			"{-} and {+} can only be applied to character classes",
+			"Macro expansion is recursive",
+			"Wrong number of macro arguments",
+			"Rule matches the empty string",
+			"Undeclared start condition",
+			"Undeclared token",
 		},
 	}
 }
@@ -39,3 +53,8 @@ func NewParseError() *ParseError {
 func (p *ParseError) ParseErr(errType ERROR_TYPE) {
 	panic(p.err_msgs[int(errType)])
 }
+
+func (p *ParseError) ParseErrDetail(errType ERROR_TYPE, detail string) {
+	//除了错误信息外再附带具体的内容，例如宏定义的展开路径
+	panic(p.err_msgs[int(errType)] + ": " + detail)
+}
@@ -0,0 +1,232 @@
+package nfa
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrClosed = errors.New("feed after close")
+
+/*
+PushScanner 用于输入分多次到达的场景，例如网络协议。调用者每收到一段数据就调用Feed，
+已经确定的token立即返回，还没有结束的token保留到下一次调用，最后调用Close取出剩下的token:
+
+	scanner := lexer.Push()
+	for chunk := range chunks {
+		tokens, _ := scanner.Feed(chunk)
+		...
+	}
+	tokens, _ := scanner.Close()
+
+它只保存当前token开始之后的字符，不需要把全部输入读入内存，token的长度受 %option maxtoken= 限制。
+
+Feed返回的多个token都在调用时的开始条件下匹配。需要根据token切换开始条件时，
+用Write写入输入，再逐个调用Next，在两次Next之间调用Begin或PushCondition:
+
+	scanner.Write(chunk)
+	for {
+		token, err := scanner.Next()
+		if token == nil || err != nil {
+			break
+		}
+		...
+	}
+*/
+type PushScanner struct {
+	lexer    *Lexer
+	pending  []byte   //当前token开始之后已经收到的字符
+	scanned  int      //pending中已经输入DFA的字符数
+	state    int      //读入scanned个字符之后DFA所在的状态
+	lastRule int      //最后一次进入接收状态时对应的规则
+	lastPos  int      //最后一次进入接收状态时读入的字符数
+	bol      bool     //当前token是否从行首开始
+	pos      Position //当前token的起始位置
+	closed   bool     //输入已经结束
+	conditionStack
+}
+
+func (l *Lexer) Push() *PushScanner {
+	s := &PushScanner{
+		lexer: l,
+		bol:   true,
+		pos:   Position{Offset: 0, Line: 1, Column: 1},
+	}
+	s.restart()
+	return s
+}
+
+func (s *PushScanner) restart() {
+	//从pending的开头按照当前的开始条件重新开始匹配一个新的token
+	s.scanned = 0
+	s.state = s.lexer.tables.Starts[s.condition]
+	if s.bol {
+		s.state = s.lexer.tables.BOLStarts[s.condition]
+	}
+	s.lastRule = UNMATCHED
+	s.lastPos = 1
+}
+
+func (s *PushScanner) accept(eol bool) {
+	/*
+		带$的规则要看下一个字符才能决定是否接收，所以读入一个字符之后的接收判断
+		推迟到下一个字符到达或者输入结束时进行
+	*/
+	rule := s.lexer.tables.AcceptRule[s.state]
+	if eol {
+		rule = s.lexer.tables.AcceptEOLRule[s.state]
+	}
+	if rule != UNMATCHED {
+		s.lastRule = rule
+		s.lastPos = s.scanned
+	}
+}
+
+func (s *PushScanner) emit() *Token {
+	//输出最长匹配的token，多读的字符留在pending中重新匹配
+	lexeme := make([]byte, s.lastPos)
+	copy(lexeme, s.pending)
+	token := s.lexer.newToken(s.lastRule, lexeme, s.pos)
+	s.pos = token.End
+	s.bol = lexeme[len(lexeme)-1] == '\n'
+	s.pending = append(s.pending[:0], s.pending[s.lastPos:]...)
+	s.restart()
+	return token
+}
+
+func (s *PushScanner) Feed(chunk []byte) ([]*Token, error) {
+	/*
+		返回这次调用中已经确定的token。只有DFA进入失败状态时才能确定最长匹配，
+		因此一个token可能跨越多次调用
+	*/
+	if err := s.Write(chunk); err != nil {
+		return nil, err
+	}
+
+	return s.drain()
+}
+
+func (s *PushScanner) Close() ([]*Token, error) {
+	//输入已经结束，把pending中剩下的字符全部匹配完
+	if err := s.CloseWrite(); err != nil {
+		return nil, err
+	}
+
+	return s.drain()
+}
+
+func (s *PushScanner) Write(chunk []byte) error {
+	//只保存新的输入，不进行匹配，之后由Next逐个取出token
+	if s.closed {
+		return ErrClosed
+	}
+
+	s.pending = append(s.pending, chunk...)
+	return nil
+}
+
+func (s *PushScanner) CloseWrite() error {
+	//表示输入已经结束，之后Next把pending中剩下的字符全部匹配完，最后返回io.EOF
+	if s.closed {
+		return ErrClosed
+	}
+
+	s.closed = true
+	return nil
+}
+
+func (s *PushScanner) drain() ([]*Token, error) {
+	tokens := make([]*Token, 0)
+	for {
+		token, err := s.Next()
+		if err == io.EOF {
+			return tokens, nil
+		}
+		if err != nil || token == nil {
+			return tokens, err
+		}
+		tokens = append(tokens, token)
+	}
+}
+
+func (s *PushScanner) Next() (*Token, error) {
+	/*
+		返回下一个已经确定的token，需要更多的输入才能确定时返回nil，
+		调用CloseWrite之后所有的输入都匹配完时返回io.EOF
+	*/
+	for len(s.pending) > 0 {
+		if s.scanned == len(s.pending) {
+			if !s.closed {
+				//需要更多的输入才能确定token在哪里结束
+				return nil, nil
+			}
+			s.accept(true)
+			return s.emit(), nil
+		}
+
+		c := s.pending[s.scanned]
+		if s.scanned > 0 {
+			s.accept(c == '\n' || c == '\r')
+		}
+		next := s.lexer.tables.Next(s.state, int(c))
+		if next == F {
+			return s.emit(), nil
+		}
+		if s.scanned >= s.lexer.Options.MaxToken {
+			if s.lastRule != UNMATCHED {
+				//超出长度之前已经有规则接收，返回最长的那个匹配
+				return s.emit(), nil
+			}
+			return nil, fmt.Errorf("%s: %w, exceeds maxtoken=%d", s.pos, ErrTokenTooLong, s.lexer.Options.MaxToken)
+		}
+		s.state = next
+		s.scanned += 1
+	}
+
+	if s.closed {
+		return nil, io.EOF
+	}
+	return nil, nil
+}
+
+func (s *PushScanner) Begin(name string) error {
+	//和Scanner.Begin一样切换开始条件，还没有返回的token按照新的开始条件重新匹配
+	if err := s.begin(s.lexer.Conditions, name); err != nil {
+		return err
+	}
+
+	s.restart()
+	return nil
+}
+
+func (s *PushScanner) PushCondition(name string) error {
+	//和Scanner.PushCondition一样，还没有返回的token按照新的开始条件重新匹配
+	if err := s.push(s.lexer.Conditions, name); err != nil {
+		return err
+	}
+
+	s.restart()
+	return nil
+}
+
+func (s *PushScanner) PopCondition() error {
+	if !s.pop() {
+		return fmt.Errorf("%s: %w", s.pos, ErrConditionStackEmpty)
+	}
+
+	s.restart()
+	return nil
+}
+
+func (s *PushScanner) TopCondition() (string, error) {
+	top, ok := s.top()
+	if !ok {
+		return "", fmt.Errorf("%s: %w", s.pos, ErrConditionStackEmpty)
+	}
+
+	return s.lexer.Conditions[top].Name, nil
+}
+
+func (s *PushScanner) Condition() string {
+	return s.lexer.Conditions[s.condition].Name
+}
@@ -0,0 +1,125 @@
+package nfa
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func feedAll(t *testing.T, lexer *Lexer, input string, size int) []*Token {
+	scanner := lexer.Push()
+	tokens := make([]*Token, 0)
+	for start := 0; start < len(input); start += size {
+		end := start + size
+		if end > len(input) {
+			end = len(input)
+		}
+		result, err := scanner.Feed([]byte(input[start:end]))
+		require.Nil(t, err)
+		tokens = append(tokens, result...)
+	}
+	result, err := scanner.Close()
+	require.Nil(t, err)
+	return append(tokens, result...)
+}
+
+func TestPushScanner(t *testing.T) {
+	//无论输入怎样分段，结果都要和一次读入全部输入时相同
+	specs := map[string]string{
+		"%%\nif   {}\n[a-z]+   {}\n[0-9]+(\\.[0-9]+)?   {}\n[ \\t\\n]+   {}\n": "if iff\n 3.14 3. ?iffy",
+		"%%\n^#[a-z]+   {}\n[a-z]+$   {}\n[a-z]+   {}\n.|\\n   {}\n":           "#if x #y\nab\n#z\r\nq",
+		"%%\nabcd   {}\nab   {}\n[a-z]   {}\n":                                 "abcabcdab",
+	}
+	for spec, input := range specs {
+		lexer, err := CompileSpec(strings.NewReader(spec))
+		require.Nil(t, err)
+		expected := scanAll(t, lexer, input)
+		for size := 1; size <= len(input); size++ {
+			require.Equal(t, expected, feedAll(t, lexer, input, size), "chunk size %d", size)
+		}
+	}
+}
+
+func TestPushScannerPending(t *testing.T) {
+	lexer, err := CompileSpec(strings.NewReader("%%\n[a-z]+   {}\n[ ]   {}\n"))
+	require.Nil(t, err)
+
+	scanner := lexer.Push()
+	tokens, err := scanner.Feed([]byte("hel"))
+	require.Nil(t, err)
+	require.Empty(t, tokens)
+	tokens, err = scanner.Feed([]byte("lo wor"))
+	require.Nil(t, err)
+	require.Equal(t, 2, len(tokens))
+	require.Equal(t, "hello", string(tokens[0].Lexeme))
+	tokens, err = scanner.Close()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(tokens))
+	require.Equal(t, "wor", string(tokens[0].Lexeme))
+	require.Equal(t, Position{Offset: 9, Line: 1, Column: 10}, tokens[0].End)
+
+	_, err = scanner.Feed([]byte("x"))
+	require.Equal(t, ErrClosed, err)
+}
+
+func TestPushScannerMaxToken(t *testing.T) {
+	lexer, err := CompileSpec(strings.NewReader("%option maxtoken=4\n%%\n@[a-z]+;   {}\n[a-z]+   {}\n[ ]   {}\n"))
+	require.Nil(t, err)
+
+	scanner := lexer.Push()
+	tokens, err := scanner.Feed([]byte("abcd ab"))
+	require.Nil(t, err)
+	require.Equal(t, 2, len(tokens))
+	//abcde超出长度之前[a-z]+已经接收了abcd
+	tokens, err = scanner.Feed([]byte("cde @"))
+	require.Nil(t, err)
+	require.Equal(t, []string{"abcd", "e", " "}, []string{string(tokens[0].Lexeme), string(tokens[1].Lexeme), string(tokens[2].Lexeme)})
+	_, err = scanner.Feed([]byte("abcde;"))
+	require.True(t, errors.Is(err, ErrTokenTooLong))
+}
+
+func TestPushScannerStartConditions(t *testing.T) {
+	//引号切换开始条件，引号之后的字符可能已经和引号在同一段输入中到达
+	spec := "%x STR\n%%\n\\\"   {}\n[a-z]+   {}\n[ ]   {}\n<STR>^#[a-z]+   {}\n<STR>[^\"\\n]+   {}\n<STR>\\n   {}\n<STR>\\\"   {}\n"
+	lexer, err := CompileSpec(strings.NewReader(spec))
+	require.Nil(t, err)
+
+	input := "ab \"cd\n#ef\" g"
+	expected := []string{"1:ab", "2: ", "0:\"", "4:cd", "5:\n", "3:#ef", "6:\"", "2: ", "1:g"}
+	for size := 1; size <= len(input); size++ {
+		scanner := lexer.Push()
+		result := make([]string, 0)
+		next := func() {
+			for {
+				token, err := scanner.Next()
+				if err == io.EOF || token == nil {
+					return
+				}
+				require.Nil(t, err)
+				switch token.Rule {
+				case 0:
+					require.Nil(t, scanner.PushCondition("STR"))
+				case 6:
+					require.Nil(t, scanner.PopCondition())
+				}
+				result = append(result, fmt.Sprintf("%d:%s", token.Rule, token.Lexeme))
+			}
+		}
+		for start := 0; start < len(input); start += size {
+			end := start + size
+			if end > len(input) {
+				end = len(input)
+			}
+			require.Nil(t, scanner.Write([]byte(input[start:end])))
+			next()
+		}
+		require.Nil(t, scanner.CloseWrite())
+		next()
+		require.Equal(t, expected, result, "chunk size %d", size)
+		require.Equal(t, INITIAL, scanner.Condition())
+	}
+}
@@ -0,0 +1,94 @@
+package nfa
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+TokenDecl 对应定义部分的 %token 声明，例如:
+%token FCON = 1
+%token ICON STRING
+没有给出值时等于前一个token的值加1，第一个token默认是1，0留给输入结束。
+代码生成器为每种语言生成TokenKind类型，常量，String()和名称表，
+规则的动作可以简写成 => NAME，表示匹配后返回NAME
+*/
+type TokenDecl struct {
+	Name  string
+	Value int
+}
+
+func (l *LexReader) TokenIndex(name string) int {
+	for i, token := range l.Tokens {
+		if token.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (l *LexReader) declareTokens(line string) {
+	//一行可以声明多个token，每个token后面可以跟 = value
+	fields := strings.Fields(strings.ReplaceAll(line, "=", " = "))
+	value := 1
+	if len(l.Tokens) > 0 {
+		value = l.Tokens[len(l.Tokens)-1].Value + 1
+	}
+	for i := 0; i < len(fields); i++ {
+		name := fields[i]
+		if !isConditionName(name) {
+			panic(fmt.Sprintf("%s: illegal token :%s", l.Position(), name))
+		}
+		if l.TokenIndex(name) != -1 || l.ConditionIndex(name) != -1 {
+			panic(fmt.Sprintf("%s: token %s redeclared", l.Position(), name))
+		}
+		if i+1 < len(fields) && fields[i+1] == "=" {
+			if i+2 >= len(fields) {
+				panic(fmt.Sprintf("%s: missing value of token %s", l.Position(), name))
+			}
+			n, err := strconv.Atoi(fields[i+2])
+			if err != nil || n <= 0 {
+				panic(fmt.Sprintf("%s: illegal token value :%s", l.Position(), fields[i+2]))
+			}
+			value = n
+			i += 2
+		}
+		l.Tokens = append(l.Tokens, &TokenDecl{Name: name, Value: value})
+		value += 1
+	}
+}
+
+func tokenAction(action string) (string, bool) {
+	//动作 => NAME 是返回token种类NAME的简写，返回NAME
+	action = strings.TrimSpace(action)
+	if !strings.HasPrefix(action, "=>") {
+		return "", false
+	}
+
+	return strings.TrimSpace(action[len("=>"):]), true
+}
+
+func tokenActionBody(action string, returnFormat string) string {
+	//=> NAME 按照returnFormat生成返回语句，其他动作和actionBody相同
+	if name, ok := tokenAction(action); ok {
+		return fmt.Sprintf(returnFormat, name)
+	}
+
+	return actionBody(action)
+}
+
+func uniqueTokenKinds(tokens []*TokenDecl) []*TokenDecl {
+	//多个token的值相同时，名称表中只保留第一个
+	seen := make(map[int]bool)
+	unique := make([]*TokenDecl, 0, len(tokens))
+	for _, token := range tokens {
+		if !seen[token.Value] {
+			seen[token.Value] = true
+			unique = append(unique, token)
+		}
+	}
+
+	return unique
+}